@@ -19,30 +19,60 @@ import (
 // AdminHandler manages admin actions, logs and violations
 type AdminHandler struct {
 	bot             *tb.Bot
+	state           core.UserState
 	blacklist       core.BlacklistInterface
+	audit           core.AuditLogInterface
+	classifier      core.SpamClassifierInterface
 	adminChatID     int64
 	violations      map[int64]int
 	violationsMu    sync.RWMutex
 	violationsFile  string
-	groupIDs        map[int64]struct{}
+	records         map[int64][]ViolationRecord
+	recordsFile     string
+	sanctions       []Sanction
+	sanctionsMu     sync.Mutex
+	sanctionsFile   string
+	history         *MessageHistory
+	purgeWindow     time.Duration
+	bans            map[int64]BanRecord
+	bansMu          sync.RWMutex
+	bansFile        string
+	groups          map[int64]string
 	groupMu         sync.RWMutex
+	groupsFile      string
 	userLanguages   map[int64]i18n.Lang
 	userLanguagesMu sync.RWMutex
 }
 
 // NewAdminHandler creates a new admin handler with persisted violations
-func NewAdminHandler(bot *tb.Bot, blacklist core.BlacklistInterface, adminChatID int64, violations map[int64]int) *AdminHandler {
+func NewAdminHandler(bot *tb.Bot, state core.UserState, blacklist core.BlacklistInterface, audit core.AuditLogInterface, classifier core.SpamClassifierInterface, adminChatID int64, violations map[int64]int) *AdminHandler {
 	_ = os.MkdirAll("data", 0755)
 	ah := &AdminHandler{
 		bot:            bot,
+		state:          state,
 		blacklist:      blacklist,
+		audit:          audit,
+		classifier:     classifier,
 		adminChatID:    adminChatID,
 		violations:     violations,
 		violationsFile: "data/violations.json",
-		groupIDs:       make(map[int64]struct{}),
+		records:        make(map[int64][]ViolationRecord),
+		recordsFile:    "data/violation_records.json",
+		bans:           make(map[int64]BanRecord),
+		bansFile:       "data/bans.json",
+		sanctionsFile:  "data/sanctions.json",
+		history:        NewMessageHistory(),
+		purgeWindow:    time.Duration(envInt("PURGE_HOURS", 24)) * time.Hour,
+		groups:         make(map[int64]string),
+		groupsFile:     "data/groups.json",
 		userLanguages:  make(map[int64]i18n.Lang),
 	}
 	ah.loadViolations()
+	ah.loadRecords()
+	ah.loadBans()
+	ah.loadGroups()
+	ah.loadSanctions()
+	go ah.runSanctionExpiry()
 	return ah
 }
 
@@ -53,6 +83,13 @@ func (ah *AdminHandler) LogToAdmin(message string) {
 	}
 }
 
+// LogToAdminWithMarkup sends a message with a keyboard to admin chat
+func (ah *AdminHandler) LogToAdminWithMarkup(message string, rm *tb.ReplyMarkup) {
+	if _, err := ah.bot.Send(&tb.Chat{ID: ah.adminChatID}, message, rm); err != nil {
+		logrus.WithError(err).WithField("admin_chat_id", ah.adminChatID).Error("Failed to send admin log")
+	}
+}
+
 // IsAdmin checks if a user is admin in chat
 func (ah *AdminHandler) IsAdmin(chat *tb.Chat, user *tb.User) bool {
 	member, err := ah.bot.ChatMemberOf(chat, user)
@@ -96,6 +133,14 @@ func (ah *AdminHandler) BanUser(chat *tb.Chat, user *tb.User) error {
 	return ah.bot.Ban(chat, &tb.ChatMember{User: user, Rights: tb.Rights{}})
 }
 
+// banUserUntil bans a user in chat until the given time, zero time means forever
+func (ah *AdminHandler) banUserUntil(chat *tb.Chat, user *tb.User, until time.Time) error {
+	if until.IsZero() {
+		return ah.BanUser(chat, user)
+	}
+	return ah.bot.Ban(chat, &tb.ChatMember{User: user, Rights: tb.Rights{}, RestrictedUntil: until.Unix()})
+}
+
 // HandleBan adds a phrase to the blocklist
 func (ah *AdminHandler) HandleBan(c tb.Context) error {
 	lang := ah.getLangForUser(c.Sender())
@@ -113,6 +158,7 @@ func (ah *AdminHandler) HandleBan(c tb.Context) error {
 		return nil
 	}
 	ah.blacklist.AddPhrase(args[1:])
+	ah.Audit(core.AuditBanWord, c.Sender(), nil, c.Chat().ID, strings.Join(args[1:], " "), "")
 	msg, _ := ah.bot.Send(c.Chat(), fmt.Sprintf(msgs.Admin.BanAdded, strings.Join(args[1:], " ")))
 	ah.DeleteAfter(msg, 10*time.Second)
 	ah.LogToAdmin(fmt.Sprintf("🚫 Добавлено запрещённое слово\n\nАдмин: %s\nЗапрещённые слова: `%s`", ah.GetUserDisplayName(c.Sender()), strings.Join(args[1:], " ")))
@@ -139,6 +185,7 @@ func (ah *AdminHandler) HandleUnban(c tb.Context) error {
 	text := msgs.Admin.UnbanNotFound
 	if ok {
 		text = fmt.Sprintf(msgs.Admin.UnbanRemoved, strings.Join(args[1:], " "))
+		ah.Audit(core.AuditUnbanWord, c.Sender(), nil, c.Chat().ID, strings.Join(args[1:], " "), "")
 		ah.LogToAdmin(fmt.Sprintf("✅ Удалено запрещённое слово\n\nАдмин: %s\nУдалённые слова: `%s`", ah.GetUserDisplayName(c.Sender()), strings.Join(args[1:], " ")))
 	}
 	msg, _ := ah.bot.Send(c.Chat(), text)
@@ -170,42 +217,38 @@ func (ah *AdminHandler) HandleListBan(c tb.Context) error {
 	return nil
 }
 
-// RegisterGroup remembers group chat for global actions
-func (ah *AdminHandler) RegisterGroup(chat *tb.Chat) {
-	if chat == nil || chat.Type == tb.ChatPrivate {
-		return
-	}
-	ah.groupMu.Lock()
-	ah.groupIDs[chat.ID] = struct{}{}
-	ah.groupMu.Unlock()
+// BanUserEverywhere bans user in all groups, adds them to the global ban list and returns the number of purged messages
+func (ah *AdminHandler) BanUserEverywhere(user *tb.User, reason, excerpt string, admin *tb.User) int {
+	return ah.BanUserEverywhereFor(user, reason, excerpt, admin, 0)
 }
 
-// AllGroupIDs returns all stored group IDs
-func (ah *AdminHandler) AllGroupIDs() []int64 {
-	ah.groupMu.RLock()
-	defer ah.groupMu.RUnlock()
-	ids := make([]int64, 0, len(ah.groupIDs))
-	for id := range ah.groupIDs {
-		ids = append(ids, id)
+// BanUserEverywhereFor bans user in all groups for a duration, zero duration means forever
+//
+// Recent messages of the user are purged, returns how many were removed.
+func (ah *AdminHandler) BanUserEverywhereFor(user *tb.User, reason, excerpt string, admin *tb.User, d time.Duration) int {
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
 	}
-	return ids
-}
-
-// BanUserEverywhere bans user in all groups
-func (ah *AdminHandler) BanUserEverywhere(user *tb.User) {
 	groupIDs := ah.AllGroupIDs()
 	if len(groupIDs) == 0 {
 		logrus.WithField("user", ah.GetUserDisplayName(user)).Warn("No group IDs registered")
 	}
 	for _, chatID := range groupIDs {
 		chat := &tb.Chat{ID: chatID}
-		err := ah.BanUser(chat, user)
+		err := ah.banUserUntil(chat, user, until)
 		if err != nil {
 			logrus.WithError(err).WithFields(logrus.Fields{"user": ah.GetUserDisplayName(user), "chat_id": chatID}).Error("Failed to ban user in group")
 		} else {
 			logrus.WithFields(logrus.Fields{"user": ah.GetUserDisplayName(user), "chat_id": chatID}).Info("User banned in group")
 		}
 	}
+	ah.recordBan(user, 0, reason, excerpt, admin, true)
+	ah.cancelSanction(user.ID, 0, sanctionBan)
+	if !until.IsZero() {
+		ah.scheduleSanction(Sanction{UserID: user.ID, User: ah.GetUserDisplayName(user), Kind: sanctionBan, Until: until})
+	}
+	return ah.PurgeUserMessages(user.ID)
 }
 
 // HandleSpamBan performs the spam ban command.
@@ -218,6 +261,12 @@ func (ah *AdminHandler) HandleSpamBan(c tb.Context) error {
 		ah.DeleteAfter(msg, 10*time.Second)
 		return nil
 	}
+	d, err := durationArg(c)
+	if err != nil {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.SpambanUsage)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
 	target := ah.resolveTargetUser(c)
 	if target == nil {
 		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.SpambanUserNotFound)
@@ -229,10 +278,67 @@ func (ah *AdminHandler) HandleSpamBan(c tb.Context) error {
 		ah.DeleteAfter(msg, 10*time.Second)
 		return nil
 	}
-	ah.BanUserEverywhere(target)
+	excerpt := ""
+	if c.Message().ReplyTo != nil {
+		excerpt = c.Message().ReplyTo.Text
+	}
+	purged := ah.BanUserEverywhereFor(target, "spamban", excerpt, c.Sender(), d)
+	if excerpt != "" && ah.classifier != nil {
+		ah.classifier.Train(excerpt, true)
+	}
 	ah.ClearViolations(target.ID)
-	_, _ = ah.bot.Send(c.Chat(), fmt.Sprintf(msgs.Admin.SpambanSuccess, ah.GetUserDisplayName(target)))
-	ah.LogToAdmin(fmt.Sprintf("🔨 Пользователь забанен за спам.\n\nЗабанен: %s\nАдмин: %s", ah.GetUserDisplayName(target), ah.GetUserDisplayName(c.Sender())))
+	if d > 0 {
+		until := time.Now().Add(d).Format("2006-01-02 15:04")
+		ah.Audit(core.AuditSpamBan, c.Sender(), target, c.Chat().ID, "spamban", "until "+until)
+		_, _ = ah.bot.Send(c.Chat(), fmt.Sprintf(msgs.Admin.SpambanSuccessUntil, ah.GetUserDisplayName(target), until)+"\n"+fmt.Sprintf(msgs.Admin.SpambanPurged, purged))
+		ah.LogToAdmin(fmt.Sprintf("🔨 Пользователь временно забанен за спам.\n\nЗабанен: %s\nДо: %s\nАдмин: %s\nУдалено сообщений: %d", ah.GetUserDisplayName(target), until, ah.GetUserDisplayName(c.Sender()), purged))
+		return nil
+	}
+	ah.Audit(core.AuditSpamBan, c.Sender(), target, c.Chat().ID, "spamban", excerpt)
+	_, _ = ah.bot.Send(c.Chat(), fmt.Sprintf(msgs.Admin.SpambanSuccess, ah.GetUserDisplayName(target))+"\n"+fmt.Sprintf(msgs.Admin.SpambanPurged, purged))
+	ah.LogToAdmin(fmt.Sprintf("🔨 Пользователь забанен за спам.\n\nЗабанен: %s\nАдмин: %s\nУдалено сообщений: %d", ah.GetUserDisplayName(target), ah.GetUserDisplayName(c.Sender()), purged))
+	return nil
+}
+
+// HandleUnspamBan lifts a global ban everywhere
+func (ah *AdminHandler) HandleUnspamBan(c tb.Context) error {
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if c.Message() == nil || c.Sender() == nil || !ah.IsAdmin(c.Chat(), c.Sender()) {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.UnspambanCommandAdminOnly)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+	target := ah.resolveTargetUserOrID(c)
+	if target == nil {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.UnspambanUsage)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+	if !ah.IsGloballyBanned(target.ID) {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.UnspambanNotFound)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+	ah.LiftGlobalBan(target)
+	ah.Audit(core.AuditUnspamBan, c.Sender(), target, c.Chat().ID, "", "")
+	_, _ = ah.bot.Send(c.Chat(), fmt.Sprintf(msgs.Admin.UnspambanSuccess, ah.GetUserDisplayName(target)))
+	ah.LogToAdmin(fmt.Sprintf("🕊 Глобальный бан снят.\n\nПользователь: %s\nАдмин: %s", ah.GetUserDisplayName(target), ah.GetUserDisplayName(c.Sender())))
+	return nil
+}
+
+// resolveTargetUserOrID finds user from reply or argument, falling back to a bare numeric ID
+func (ah *AdminHandler) resolveTargetUserOrID(c tb.Context) *tb.User {
+	if target := ah.resolveTargetUser(c); target != nil {
+		return target
+	}
+	args := strings.Fields(c.Message().Text)
+	if len(args) >= 2 {
+		if id, err := strconv.ParseInt(args[1], 10, 64); err == nil {
+			return &tb.User{ID: id}
+		}
+	}
 	return nil
 }
 
@@ -246,26 +352,40 @@ func (ah *AdminHandler) resolveTargetUser(c tb.Context) *tb.User {
 		return nil
 	}
 	idStr := args[1]
-	if strings.HasPrefix(idStr, "@") {
-		m, err := ah.bot.ChatMemberOf(c.Chat(), &tb.User{Username: idStr[1:]})
-		if err == nil && m.User != nil {
-			return m.User
+	chats := []*tb.Chat{c.Chat()}
+	for _, id := range ah.AllGroupIDs() {
+		if id != c.Chat().ID {
+			chats = append(chats, &tb.Chat{ID: id})
 		}
-	} else if id, err := strconv.ParseInt(idStr, 10, 64); err == nil {
-		m, err := ah.bot.ChatMemberOf(c.Chat(), &tb.User{ID: id})
-		if err == nil && m.User != nil {
-			return m.User
+	}
+	for _, chat := range chats {
+		if strings.HasPrefix(idStr, "@") {
+			m, err := ah.bot.ChatMemberOf(chat, &tb.User{Username: idStr[1:]})
+			if err == nil && m.User != nil {
+				return m.User
+			}
+		} else if id, err := strconv.ParseInt(idStr, 10, 64); err == nil {
+			m, err := ah.bot.ChatMemberOf(chat, &tb.User{ID: id})
+			if err == nil && m.User != nil {
+				return m.User
+			}
 		}
 	}
 	return nil
 }
 
-// AddViolation increments violation count
-func (ah *AdminHandler) AddViolation(userID int64) {
+// AddViolation increments violation count and records what was violated
+func (ah *AdminHandler) AddViolation(userID, chatID int64, rule, excerpt string) {
 	ah.violationsMu.Lock()
 	ah.violations[userID]++
+	list := append(ah.records[userID], ViolationRecord{Rule: rule, Excerpt: truncate(excerpt, maxExcerptLen), ChatID: chatID, Time: time.Now()})
+	if len(list) > maxRecordsPerUser {
+		list = list[len(list)-maxRecordsPerUser:]
+	}
+	ah.records[userID] = list
 	ah.violationsMu.Unlock()
 	ah.saveViolations()
+	ah.saveRecords()
 }
 
 // GetViolations returns count
@@ -280,8 +400,10 @@ func (ah *AdminHandler) GetViolations(userID int64) int {
 func (ah *AdminHandler) ClearViolations(userID int64) {
 	ah.violationsMu.Lock()
 	delete(ah.violations, userID)
+	delete(ah.records, userID)
 	ah.violationsMu.Unlock()
 	ah.saveViolations()
+	ah.saveRecords()
 }
 
 // saveViolations persists violation count to disk
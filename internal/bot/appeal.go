@@ -0,0 +1,296 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+const (
+	appealPending  = "pending"
+	appealRejected = "rejected"
+)
+
+// BanRecord describes why and by whom a user was banned
+type BanRecord struct {
+	UserID       int64     `json:"user_id"`
+	User         string    `json:"user"`
+	ChatID       int64     `json:"chat_id"`
+	Reason       string    `json:"reason"`
+	Excerpt      string    `json:"excerpt,omitempty"`
+	Violations   int       `json:"violations"`
+	Global       bool      `json:"global"`
+	Until        time.Time `json:"until,omitempty"`
+	Admin        string    `json:"admin,omitempty"`
+	Time         time.Time `json:"time"`
+	Appeal       string    `json:"appeal,omitempty"`
+	AppealLang   string    `json:"appeal_lang,omitempty"`
+	AppealReason string    `json:"appeal_reason,omitempty"`
+}
+
+// AppealApproveButton returns approve button for appeals
+func AppealApproveButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("appeal_approve", msgs.Appeal.ApproveButton)
+}
+
+// AppealRejectButton returns reject button for appeals
+func AppealRejectButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("appeal_reject", msgs.Appeal.RejectButton)
+}
+
+// RecordBan remembers the ban context so that the user can appeal it later
+func (ah *AdminHandler) RecordBan(user *tb.User, chatID int64, reason, excerpt string, admin *tb.User) {
+	ah.recordBan(user, chatID, reason, excerpt, admin, false)
+}
+
+// recordBan stores a ban record, global records are enforced on join in every group
+func (ah *AdminHandler) recordBan(user *tb.User, chatID int64, reason, excerpt string, admin *tb.User, global bool) {
+	if user == nil {
+		return
+	}
+	rec := BanRecord{
+		UserID:     user.ID,
+		User:       ah.GetUserDisplayName(user),
+		ChatID:     chatID,
+		Reason:     reason,
+		Excerpt:    truncate(excerpt, maxExcerptLen),
+		Violations: ah.GetViolations(user.ID),
+		Global:     global,
+		Time:       time.Now(),
+	}
+	if admin != nil {
+		rec.Admin = ah.GetUserDisplayName(admin)
+	}
+	ah.bansMu.Lock()
+	if prev, ok := ah.bans[user.ID]; ok && prev.Global && !global {
+		// A local ban must not downgrade an existing global one
+		rec.Global = true
+	}
+	ah.bans[user.ID] = rec
+	ah.bansMu.Unlock()
+	ah.saveBans()
+}
+
+// IsGloballyBanned reports whether the user is on the global ban list
+func (ah *AdminHandler) IsGloballyBanned(userID int64) bool {
+	ah.bansMu.RLock()
+	defer ah.bansMu.RUnlock()
+	return ah.bans[userID].Global
+}
+
+// LiftGlobalBan unbans the user everywhere and removes the ban record
+func (ah *AdminHandler) LiftGlobalBan(user *tb.User) {
+	ah.UnbanUserEverywhere(user)
+	ah.bansMu.Lock()
+	delete(ah.bans, user.ID)
+	ah.bansMu.Unlock()
+	ah.saveBans()
+	ah.cancelSanction(user.ID, 0, sanctionBan)
+}
+
+// BanRecordOf returns the ban record of a user
+func (ah *AdminHandler) BanRecordOf(userID int64) (BanRecord, bool) {
+	ah.bansMu.RLock()
+	defer ah.bansMu.RUnlock()
+	rec, ok := ah.bans[userID]
+	return rec, ok
+}
+
+// HandleAppeal lets a banned user ask admins to lift the ban
+func (ah *AdminHandler) HandleAppeal(c tb.Context) error {
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if c.Message() == nil || c.Sender() == nil {
+		return nil
+	}
+	if c.Chat().Type != tb.ChatPrivate {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Appeal.PrivateOnly)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+
+	userID := c.Sender().ID
+	ah.bansMu.Lock()
+	rec, ok := ah.bans[userID]
+	switch {
+	case !ok:
+		ah.bansMu.Unlock()
+		_, err := ah.bot.Send(c.Chat(), msgs.Appeal.NoBan)
+		return err
+	case rec.Appeal == appealPending:
+		ah.bansMu.Unlock()
+		_, err := ah.bot.Send(c.Chat(), msgs.Appeal.AlreadyPending)
+		return err
+	case rec.Appeal == appealRejected:
+		ah.bansMu.Unlock()
+		_, err := ah.bot.Send(c.Chat(), msgs.Appeal.AlreadyReviewed)
+		return err
+	}
+	rec.Appeal = appealPending
+	rec.AppealLang = string(lang)
+	rec.AppealReason = truncate(strings.TrimSpace(c.Message().Payload), maxExcerptLen)
+	ah.bans[userID] = rec
+	ah.bansMu.Unlock()
+	ah.saveBans()
+
+	adminMsgs := i18n.Get().T(i18n.Get().GetDefault())
+	approveBtn := AppealApproveButton()
+	approveBtn.Text = adminMsgs.Appeal.ApproveButton
+	approveBtn.Data = strconv.FormatInt(userID, 10)
+	rejectBtn := AppealRejectButton()
+	rejectBtn.Text = adminMsgs.Appeal.RejectButton
+	rejectBtn.Data = strconv.FormatInt(userID, 10)
+	kb := &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{approveBtn, rejectBtn}}}
+
+	appealText := rec.AppealReason
+	if appealText == "" {
+		appealText = "—"
+	}
+	logMsg := fmt.Sprintf("📨 Апелляция на бан.\n\nПользователь: %s\nПричина бана: %s\nАдмин: %s\nНарушений сейчас: %d (на момент бана: %d)\nСообщение: «%s»\nТекст апелляции: «%s»",
+		ah.GetUserDisplayName(c.Sender()), rec.Reason, orDash(rec.Admin), ah.GetViolations(userID), rec.Violations, orDash(rec.Excerpt), appealText)
+	if _, err := ah.bot.Send(&tb.Chat{ID: ah.adminChatID}, logMsg, kb); err != nil {
+		logrus.WithError(err).WithField("user_id", userID).Error("Failed to send appeal to admin chat")
+	}
+	_, err := ah.bot.Send(c.Chat(), msgs.Appeal.Sent)
+	logrus.WithField("user_id", userID).Info("Ban appeal submitted")
+	return err
+}
+
+// appealCallbackTarget validates the clicker and returns the pending appeal
+func (ah *AdminHandler) appealCallbackTarget(c tb.Context) (BanRecord, bool) {
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	cb := c.Callback()
+	if cb == nil || c.Sender() == nil {
+		return BanRecord{}, false
+	}
+	if !ah.IsAdmin(&tb.Chat{ID: ah.adminChatID}, c.Sender()) {
+		_ = ah.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Buttons.NotYourButton})
+		return BanRecord{}, false
+	}
+	userID, err := strconv.ParseInt(cb.Data, 10, 64)
+	if err != nil {
+		_ = ah.bot.Respond(cb)
+		return BanRecord{}, false
+	}
+	rec, ok := ah.BanRecordOf(userID)
+	if !ok || rec.Appeal != appealPending {
+		_ = ah.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Appeal.AlreadyHandled})
+		_, _ = ah.bot.EditReplyMarkup(c.Message(), nil)
+		return BanRecord{}, false
+	}
+	return rec, true
+}
+
+// HandleAppealApprove unbans the user everywhere and notifies them
+func (ah *AdminHandler) HandleAppealApprove(c tb.Context) error {
+	rec, ok := ah.appealCallbackTarget(c)
+	if !ok {
+		return nil
+	}
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	user := &tb.User{ID: rec.UserID}
+	ah.LiftGlobalBan(user)
+	ah.ClearViolations(rec.UserID)
+	ah.Audit(core.AuditAppealApproved, c.Sender(), user, rec.ChatID, rec.Reason, rec.AppealReason)
+
+	userMsgs := i18n.Get().T(i18n.Lang(rec.AppealLang))
+	if _, err := ah.bot.Send(user, userMsgs.Appeal.Approved); err != nil {
+		logrus.WithError(err).WithField("user_id", rec.UserID).Warn("Failed to notify user about approved appeal")
+	}
+
+	note := fmt.Sprintf(msgs.Appeal.ApprovedBy, ah.GetUserDisplayName(c.Sender()))
+	_ = ah.bot.Respond(c.Callback(), &tb.CallbackResponse{Text: note})
+	_, _ = ah.bot.Edit(c.Message(), c.Message().Text+"\n\n"+note)
+	logrus.WithFields(logrus.Fields{"user_id": rec.UserID, "admin_id": c.Sender().ID}).Info("Ban appeal approved")
+	return nil
+}
+
+// HandleAppealReject keeps the ban and notifies the user
+func (ah *AdminHandler) HandleAppealReject(c tb.Context) error {
+	rec, ok := ah.appealCallbackTarget(c)
+	if !ok {
+		return nil
+	}
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	ah.bansMu.Lock()
+	rec.Appeal = appealRejected
+	ah.bans[rec.UserID] = rec
+	ah.bansMu.Unlock()
+	ah.saveBans()
+	ah.Audit(core.AuditAppealRejected, c.Sender(), &tb.User{ID: rec.UserID}, rec.ChatID, rec.Reason, rec.AppealReason)
+
+	userMsgs := i18n.Get().T(i18n.Lang(rec.AppealLang))
+	if _, err := ah.bot.Send(&tb.User{ID: rec.UserID}, userMsgs.Appeal.Rejected); err != nil {
+		logrus.WithError(err).WithField("user_id", rec.UserID).Warn("Failed to notify user about rejected appeal")
+	}
+
+	note := fmt.Sprintf(msgs.Appeal.RejectedBy, ah.GetUserDisplayName(c.Sender()))
+	_ = ah.bot.Respond(c.Callback(), &tb.CallbackResponse{Text: note})
+	_, _ = ah.bot.Edit(c.Message(), c.Message().Text+"\n\n"+note)
+	logrus.WithFields(logrus.Fields{"user_id": rec.UserID, "admin_id": c.Sender().ID}).Info("Ban appeal rejected")
+	return nil
+}
+
+// UnbanUserEverywhere lifts the ban in all groups
+func (ah *AdminHandler) UnbanUserEverywhere(user *tb.User) {
+	for _, chatID := range ah.AllGroupIDs() {
+		if err := ah.bot.Unban(&tb.Chat{ID: chatID}, user, true); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"user_id": user.ID, "chat_id": chatID}).Error("Failed to unban user in group")
+		} else {
+			logrus.WithFields(logrus.Fields{"user_id": user.ID, "chat_id": chatID}).Info("User unbanned in group")
+		}
+	}
+}
+
+// orDash returns a dash for empty strings
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
+
+// saveBans persists ban records to disk
+func (ah *AdminHandler) saveBans() {
+	ah.bansMu.RLock()
+	data, err := json.MarshalIndent(ah.bans, "", "  ")
+	ah.bansMu.RUnlock()
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(ah.bansFile, data, 0644)
+}
+
+// loadBans reads ban records from disk
+func (ah *AdminHandler) loadBans() {
+	data, err := os.ReadFile(ah.bansFile)
+	if err != nil {
+		return
+	}
+	ah.bansMu.Lock()
+	_ = json.Unmarshal(data, &ah.bans)
+	if ah.bans == nil {
+		ah.bans = make(map[int64]BanRecord)
+	}
+	ah.bansMu.Unlock()
+}
@@ -0,0 +1,237 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+const auditShowLimit = 20
+
+// AuditLog stores audit events as JSON Lines in data/
+type AuditLog struct {
+	mu   sync.Mutex
+	file string
+}
+
+// NewAuditLog creates an audit log backed by a JSON Lines file in data/
+func NewAuditLog(file string) core.AuditLogInterface {
+	dataDir := "data"
+	_ = os.MkdirAll(dataDir, 0755)
+	if !strings.HasPrefix(file, "data/") {
+		file = "data/" + file
+	}
+	return &AuditLog{file: file}
+}
+
+// Record appends an event to the log
+func (a *AuditLog) Record(ev core.AuditEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		logrus.WithError(err).Error("audit marshal")
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.OpenFile(a.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logrus.WithError(err).Error("audit open")
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		logrus.WithError(err).Error("audit write")
+	}
+}
+
+// Query returns events matching the filter in chronological order
+func (a *AuditLog) Query(flt core.AuditFilter) ([]core.AuditEvent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.Open(a.file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	var out []core.AuditEvent
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var ev core.AuditEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			continue
+		}
+		if auditMatches(ev, flt) {
+			out = append(out, ev)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return out, fmt.Errorf("read: %w", err)
+	}
+	return out, nil
+}
+
+// auditMatches checks a single event against the filter
+func auditMatches(ev core.AuditEvent, flt core.AuditFilter) bool {
+	if flt.Action != "" && ev.Action != flt.Action {
+		return false
+	}
+	if flt.Actor != "" && !auditUserMatches(ev.ActorID, ev.Actor, flt.Actor) {
+		return false
+	}
+	if flt.Target != "" && !auditUserMatches(ev.TargetID, ev.Target, flt.Target) {
+		return false
+	}
+	if !flt.From.IsZero() && ev.Time.Before(flt.From) {
+		return false
+	}
+	if !flt.To.IsZero() && !ev.Time.Before(flt.To) {
+		return false
+	}
+	return true
+}
+
+// auditUserMatches compares a user reference given as ID or @username
+func auditUserMatches(id int64, name, ref string) bool {
+	if n, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return id == n
+	}
+	return strings.EqualFold(name, ref)
+}
+
+// Audit records a moderation event about target performed by actor
+func (ah *AdminHandler) Audit(action string, actor, target *tb.User, chatID int64, rule, details string) {
+	if ah.audit == nil {
+		return
+	}
+	ev := core.AuditEvent{Action: action, ChatID: chatID, Rule: rule, Details: truncate(details, maxExcerptLen)}
+	if actor != nil {
+		ev.ActorID = actor.ID
+		ev.Actor = ah.GetUserDisplayName(actor)
+	}
+	if target != nil {
+		ev.TargetID = target.ID
+		ev.Target = ah.GetUserDisplayName(target)
+	}
+	ah.audit.Record(ev)
+}
+
+// HandleAudit shows or exports audit events: /audit [export] [admin=..] [user=..] [action=..] [from=YYYY-MM-DD] [to=YYYY-MM-DD]
+func (ah *AdminHandler) HandleAudit(c tb.Context) error {
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	// The log covers every group, so it is shown only to admins in the admin chat
+	if c.Message() == nil || c.Sender() == nil || c.Chat().ID != ah.adminChatID || !ah.IsAdmin(c.Chat(), c.Sender()) {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.AuditCommandAdminOnly)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+	if ah.audit == nil {
+		return nil
+	}
+	export, flt, err := parseAuditArgs(strings.Fields(c.Message().Text)[1:])
+	if err != nil {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.AuditUsage)
+		ah.DeleteAfter(msg, 20*time.Second)
+		return nil
+	}
+	events, err := ah.audit.Query(flt)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to query audit log")
+	}
+	if len(events) == 0 {
+		_, _ = ah.bot.Send(c.Chat(), msgs.Admin.AuditEmpty)
+		return nil
+	}
+
+	if export {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, ev := range events {
+			_ = enc.Encode(ev)
+		}
+		doc := &tb.Document{
+			File:     tb.FromReader(&buf),
+			FileName: fmt.Sprintf("audit-%s.jsonl", time.Now().Format("20060102-150405")),
+			Caption:  fmt.Sprintf(msgs.Admin.AuditExported, len(events)),
+		}
+		_, err := ah.bot.Send(c.Chat(), doc)
+		return err
+	}
+
+	shown := events
+	if len(shown) > auditShowLimit {
+		shown = shown[len(shown)-auditShowLimit:]
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(msgs.Admin.AuditHeader, len(shown), len(events)))
+	for _, ev := range shown {
+		sb.WriteString(fmt.Sprintf("%s · %s · %s → %s", ev.Time.Format("2006-01-02 15:04"), ev.Action, orDash(ev.Actor), orDash(ev.Target)))
+		if ev.ChatID != 0 {
+			sb.WriteString(fmt.Sprintf(" · %d", ev.ChatID))
+		}
+		if ev.Rule != "" {
+			sb.WriteString(" · " + ev.Rule)
+		}
+		sb.WriteString("\n")
+	}
+	_, err = ah.bot.Send(c.Chat(), sb.String())
+	return err
+}
+
+// parseAuditArgs parses /audit arguments into a filter
+func parseAuditArgs(args []string) (bool, core.AuditFilter, error) {
+	var flt core.AuditFilter
+	export := false
+	for _, arg := range args {
+		if arg == "export" {
+			export = true
+			continue
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return false, flt, fmt.Errorf("bad argument %q", arg)
+		}
+		switch key {
+		case "admin":
+			flt.Actor = value
+		case "user":
+			flt.Target = value
+		case "action":
+			flt.Action = value
+		case "from", "to":
+			t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return false, flt, fmt.Errorf("bad date %q: %w", value, err)
+			}
+			if key == "from" {
+				flt.From = t
+			} else {
+				flt.To = t.AddDate(0, 0, 1)
+			}
+		default:
+			return false, flt, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return export, flt, nil
+}
@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"UEPB/internal/core"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// banListEntry is a cached lookup result
+type banListEntry struct {
+	listed  bool
+	reason  string
+	expires time.Time
+}
+
+// HTTPBanList queries a CAS-style HTTP API, the URL template must contain {id}
+//
+// The response is expected to be JSON like {"ok": true, "description": "..."}, where ok means the user is listed.
+type HTTPBanList struct {
+	urlTemplate string
+	client      *http.Client
+	ttl         time.Duration
+	mu          sync.Mutex
+	cache       map[int64]banListEntry
+}
+
+// NewHTTPBanList creates an HTTP ban list provider with a request timeout and a result cache TTL
+func NewHTTPBanList(urlTemplate string, timeout, ttl time.Duration) *HTTPBanList {
+	return &HTTPBanList{
+		urlTemplate: urlTemplate,
+		client:      &http.Client{Timeout: timeout},
+		ttl:         ttl,
+		cache:       make(map[int64]banListEntry),
+	}
+}
+
+// BanListFromEnv returns the provider configured by BANLIST_URL, or nil if it is not set
+func BanListFromEnv() core.BanListProvider {
+	url := envString("BANLIST_URL", "")
+	if url == "" {
+		return nil
+	}
+	return NewHTTPBanList(url, envDuration("BANLIST_TIMEOUT", 3*time.Second), envDuration("BANLIST_CACHE_TTL", time.Hour))
+}
+
+// Lookup checks whether the user is listed, errors are not cached
+func (bl *HTTPBanList) Lookup(userID int64) (bool, string, error) {
+	now := time.Now()
+	bl.mu.Lock()
+	if e, ok := bl.cache[userID]; ok && now.Before(e.expires) {
+		bl.mu.Unlock()
+		return e.listed, e.reason, nil
+	}
+	bl.mu.Unlock()
+
+	url := strings.ReplaceAll(bl.urlTemplate, "{id}", strconv.FormatInt(userID, 10))
+	resp, err := bl.client.Get(url)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("ban list returned status %d", resp.StatusCode)
+	}
+	var body struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body); err != nil {
+		return false, "", err
+	}
+
+	e := banListEntry{listed: body.Ok, reason: body.Description, expires: now.Add(bl.ttl)}
+	bl.mu.Lock()
+	bl.cache[userID] = e
+	// Drop expired entries so the cache doesn't grow forever
+	if len(bl.cache) > 10000 {
+		for id, x := range bl.cache {
+			if now.After(x.expires) {
+				delete(bl.cache, id)
+			}
+		}
+	}
+	bl.mu.Unlock()
+	return e.listed, e.reason, nil
+}
+
+// checkBanList bans a joining user found in the external ban list, returns true if the user was banned
+func (fh *FeatureHandler) checkBanList(chat *tb.Chat, u *tb.User) bool {
+	if fh.banList == nil {
+		return false
+	}
+	listed, reason, err := fh.banList.Lookup(u.ID)
+	if err != nil {
+		// Fail open, an unavailable database must not block joins
+		logrus.WithError(err).WithField("user_id", u.ID).Warn("Ban list lookup failed")
+		return false
+	}
+	if !listed {
+		return false
+	}
+	if err := fh.adminHandler.BanUser(chat, u); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": chat.ID, "user_id": u.ID}).Error("Failed to ban user from ban list")
+		return false
+	}
+	reason = orDash(reason)
+	fh.adminHandler.RecordBan(u, chat.ID, "external ban list", reason, nil)
+	fh.adminHandler.Audit(core.AuditBanListJoin, nil, u, chat.ID, "external ban list", reason)
+	logMsg := fmt.Sprintf("🌐 Пользователь найден во внешнем бан-листе и забанен при входе.\n\nПользователь: %s\nЧат: %s\nПричина: %s", fh.adminHandler.GetUserDisplayName(u), chat.Title, reason)
+	fh.adminHandler.LogToAdmin(logMsg)
+	logrus.WithFields(logrus.Fields{"chat_id": chat.ID, "user_id": u.ID}).Info("User banned from external ban list")
+	return true
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tb "gopkg.in/telebot.v4"
+)
+
+// newBanListServer answers like CAS, user 1 is listed, every request is counted
+func newBanListServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Query().Get("user_id") == "1" {
+			fmt.Fprint(w, `{"ok": true, "description": "spam bot"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok": false, "description": "not found"}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBanListHit(t *testing.T) {
+	var requests atomic.Int32
+	srv := newBanListServer(t, &requests)
+	bl := NewHTTPBanList(srv.URL+"/check?user_id={id}", time.Second, time.Hour)
+
+	listed, reason, err := bl.Lookup(1)
+	if err != nil || !listed || reason != "spam bot" {
+		t.Fatalf("Lookup(1) = %v, %q, %v", listed, reason, err)
+	}
+}
+
+func TestBanListMiss(t *testing.T) {
+	var requests atomic.Int32
+	srv := newBanListServer(t, &requests)
+	bl := NewHTTPBanList(srv.URL+"/check?user_id={id}", time.Second, time.Hour)
+
+	listed, _, err := bl.Lookup(2)
+	if err != nil || listed {
+		t.Fatalf("Lookup(2) = %v, %v", listed, err)
+	}
+}
+
+func TestBanListCache(t *testing.T) {
+	var requests atomic.Int32
+	srv := newBanListServer(t, &requests)
+	bl := NewHTTPBanList(srv.URL+"/check?user_id={id}", time.Second, time.Hour)
+
+	for range 3 {
+		if listed, _, err := bl.Lookup(1); err != nil || !listed {
+			t.Fatalf("Lookup(1) = %v, %v", listed, err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("%d requests for a cached user, want 1", n)
+	}
+
+	expired := NewHTTPBanList(srv.URL+"/check?user_id={id}", time.Second, 0)
+	expired.Lookup(2)
+	expired.Lookup(2)
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("%d requests in total, an expired entry must be fetched again", n)
+	}
+}
+
+func TestBanListFailsOpen(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, `{"ok": true}`)
+	}))
+	defer slow.Close()
+
+	for name, url := range map[string]string{"error": failing.URL, "timeout": slow.URL} {
+		bl := NewHTTPBanList(url+"/check?user_id={id}", 50*time.Millisecond, time.Hour)
+		if _, _, err := bl.Lookup(1); err == nil {
+			t.Errorf("%s: no error returned", name)
+		}
+		if _, ok := bl.cache[1]; ok {
+			t.Errorf("%s: failed lookup cached", name)
+		}
+		fh := &FeatureHandler{banList: bl}
+		if fh.checkBanList(&tb.Chat{ID: -100}, &tb.User{ID: 1}) {
+			t.Errorf("%s: user banned although the lookup failed", name)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"UEPB/internal/core"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	bayesMinToken   = 2
+	bayesMaxToken   = 30
+	bayesSaveEvery  = time.Minute
+	bayesMinTrainOn = 3
+)
+
+// Bayes is a naive Bayes spam classifier backed by a JSON file in data/
+type Bayes struct {
+	mu        sync.RWMutex
+	SpamDocs  int            `json:"spam_docs"`
+	HamDocs   int            `json:"ham_docs"`
+	SpamWords map[string]int `json:"spam_words"`
+	HamWords  map[string]int `json:"ham_words"`
+	minDocs   int
+	maxWords  int
+	dirty     bool
+	file      string
+}
+
+// NewBayes creates the classifier and starts the periodic saver
+func NewBayes(file string) core.SpamClassifierInterface {
+	_ = os.MkdirAll("data", 0755)
+	if !strings.HasPrefix(file, "data/") {
+		file = "data/" + file
+	}
+	b := &Bayes{SpamWords: make(map[string]int), HamWords: make(map[string]int), minDocs: envInt("BAYES_MIN_DOCS", 20), maxWords: envInt("BAYES_MAX_WORDS", 50000), file: file}
+	b.load()
+	pruneWords(b.SpamWords, b.maxWords)
+	pruneWords(b.HamWords, b.maxWords)
+	go b.runSaver()
+	return b
+}
+
+// tokenize splits text into distinct lowercase words
+func tokenize(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		n := utf8.RuneCountInString(w)
+		if n < bayesMinToken || n > bayesMaxToken || seen[w] {
+			continue
+		}
+		seen[w] = true
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
+
+// Train adds a message to the spam or ham corpus
+func (b *Bayes) Train(text string, spam bool) {
+	tokens := tokenize(text)
+	if len(tokens) < bayesMinTrainOn {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	words := b.HamWords
+	if spam {
+		b.SpamDocs++
+		words = b.SpamWords
+	} else {
+		b.HamDocs++
+	}
+	for _, t := range tokens {
+		words[t]++
+	}
+	pruneWords(words, b.maxWords)
+	b.dirty = true
+}
+
+// pruneWords drops the rarest words once a vocabulary exceeds capacity, down to 90% of it so pruning doesn't run on every message
+func pruneWords(words map[string]int, capacity int) {
+	if capacity <= 0 || len(words) <= capacity {
+		return
+	}
+	target := capacity * 9 / 10
+	for limit := 1; len(words) > target; limit++ {
+		for w, n := range words {
+			if n <= limit {
+				delete(words, w)
+			}
+		}
+	}
+}
+
+// Score returns the spam probability of a message, false until both corpora are large enough
+func (b *Bayes) Score(text string) (float64, bool) {
+	tokens := tokenize(text)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(tokens) == 0 || b.SpamDocs < b.minDocs || b.HamDocs < b.minDocs {
+		return 0, false
+	}
+
+	// Equal priors, the ham corpus grows much faster than the spam one
+	logSpam, logHam := 0.0, 0.0
+	for _, t := range tokens {
+		s, h := b.SpamWords[t], b.HamWords[t]
+		if s == 0 && h == 0 {
+			continue
+		}
+		// Laplace smoothing over per-document word presence
+		logSpam += math.Log(float64(s+1) / float64(b.SpamDocs+2))
+		logHam += math.Log(float64(h+1) / float64(b.HamDocs+2))
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam)), true
+}
+
+// runSaver persists the corpus periodically, training happens on every message so saving each time is too expensive
+func (b *Bayes) runSaver() {
+	ticker := time.NewTicker(bayesSaveEvery)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.save()
+	}
+}
+
+// save persists the corpus to disk if it changed
+func (b *Bayes) save() {
+	b.mu.Lock()
+	if !b.dirty {
+		b.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(b)
+	b.dirty = false
+	b.mu.Unlock()
+	if err != nil {
+		logrus.WithError(err).Error("bayes marshal")
+		return
+	}
+	_ = os.WriteFile(b.file, data, 0644)
+}
+
+// load reads the corpus from disk
+func (b *Bayes) load() {
+	data, err := os.ReadFile(b.file)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, b)
+	if b.SpamWords == nil {
+		b.SpamWords = make(map[string]int)
+	}
+	if b.HamWords == nil {
+		b.HamWords = make(map[string]int)
+	}
+}
@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Free CRYPTO, free crypto!!! a https://t.me/x supercalifragilisticexpialidociousness")
+	want := []string{"free", "crypto", "https", "me"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("tokenize = %q, want %q", got, want)
+	}
+}
+
+func newTestBayes(minDocs int) *Bayes {
+	return &Bayes{SpamWords: make(map[string]int), HamWords: make(map[string]int), minDocs: minDocs}
+}
+
+func TestBayesNeedsCorpus(t *testing.T) {
+	b := newTestBayes(2)
+	b.Train("earn money fast with crypto", true)
+	b.Train("see you at the lecture tomorrow", false)
+	if _, ok := b.Score("earn money fast"); ok {
+		t.Fatal("scored before both corpora reached the minimum")
+	}
+}
+
+func TestBayesScore(t *testing.T) {
+	b := newTestBayes(2)
+	for _, text := range []string{"earn money fast with crypto signals", "crypto investment earn money daily", "fast money crypto profit guaranteed"} {
+		b.Train(text, true)
+	}
+	for _, text := range []string{"see you at the lecture tomorrow", "who has notes from the statistics lecture", "the exam room changed to building"} {
+		b.Train(text, false)
+	}
+	spam, ok := b.Score("earn crypto money now")
+	if !ok || spam < 0.9 {
+		t.Errorf("spam score = %.2f, %v", spam, ok)
+	}
+	ham, ok := b.Score("notes from the lecture")
+	if !ok || ham > 0.1 {
+		t.Errorf("ham score = %.2f, %v", ham, ok)
+	}
+}
+
+func TestBayesIgnoresShortMessages(t *testing.T) {
+	b := newTestBayes(1)
+	b.Train("ok thanks", true)
+	if b.SpamDocs != 0 || len(b.SpamWords) != 0 {
+		t.Fatal("trained on a message with too few tokens")
+	}
+}
+
+func TestPruneWords(t *testing.T) {
+	words := map[string]int{"common": 5, "frequent": 3}
+	for i := range 20 {
+		words[fmt.Sprintf("rare%d", i)] = 1
+	}
+	pruneWords(words, 10)
+	if len(words) > 10 {
+		t.Fatalf("%d words left over capacity", len(words))
+	}
+	if words["common"] != 5 || words["frequent"] != 3 {
+		t.Fatal("frequent words pruned")
+	}
+}
@@ -60,6 +60,12 @@ func (b *Blacklist) RemovePhrase(words []string) bool {
 
 // CheckMessage checks if a message contains any blacklisted phrases
 func (b *Blacklist) CheckMessage(msg string) bool {
+	_, ok := b.Match(msg)
+	return ok
+}
+
+// Match returns the first blacklisted phrase found in a message
+func (b *Blacklist) Match(msg string) ([]string, bool) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	text := strings.ToLower(msg)
@@ -68,7 +74,7 @@ func (b *Blacklist) CheckMessage(msg string) bool {
 		if len(phrase) == 1 {
 			for _, w := range words {
 				if w == phrase[0] {
-					return true
+					return phrase, true
 				}
 			}
 			continue
@@ -81,10 +87,10 @@ func (b *Blacklist) CheckMessage(msg string) bool {
 			}
 		}
 		if found {
-			return true
+			return phrase, true
 		}
 	}
-	return false
+	return nil, false
 }
 
 // List returns a copy of the blacklisted phrases
@@ -0,0 +1,421 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// verifiers are the CAPTCHA methods a chat may pick instead of the student options
+var verifiers = map[string]core.Verifier{
+	core.VerifyArithmetic: arithmeticVerifier{},
+	core.VerifyEmoji:      emojiVerifier{},
+	core.VerifyImage:      imageVerifier{},
+}
+
+// verifyMethods returns the names of all verification methods
+func verifyMethods() []string {
+	methods := []string{core.VerifyQuiz, core.VerifyEmail}
+	for name := range verifiers {
+		methods = append(methods, name)
+	}
+	slices.Sort(methods)
+	return methods
+}
+
+// validMethod reports whether a verification method is known
+func validMethod(method string) bool {
+	return slices.Contains(verifyMethods(), method)
+}
+
+// captchaOptions is the number of answer buttons of a challenge
+const captchaOptions = 6
+
+// withDecoys builds a challenge from the right answer and decoys, in random order
+func withDecoys(prompt string, img []byte, answer string, n int, decoy func() string) core.Challenge {
+	options := []string{answer}
+	for len(options) < n {
+		if d := decoy(); !slices.Contains(options, d) {
+			options = append(options, d)
+		}
+	}
+	rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+	return core.Challenge{Prompt: prompt, Image: img, Options: options, Answer: slices.Index(options, answer)}
+}
+
+// arithmeticVerifier asks to solve a small sum, difference or product
+type arithmeticVerifier struct{}
+
+// NewChallenge creates an arithmetic challenge
+func (arithmeticVerifier) NewChallenge() core.Challenge {
+	a, b := rand.IntN(20)+1, rand.IntN(20)+1
+	var prompt string
+	var result int
+	switch rand.IntN(3) {
+	case 0:
+		prompt, result = fmt.Sprintf("%d + %d", a, b), a+b
+	case 1:
+		if a < b {
+			a, b = b, a
+		}
+		prompt, result = fmt.Sprintf("%d − %d", a, b), a-b
+	default:
+		a, b = a%8+2, b%8+2
+		prompt, result = fmt.Sprintf("%d × %d", a, b), a*b
+	}
+	return withDecoys(prompt, nil, strconv.Itoa(result), captchaOptions, func() string {
+		return strconv.Itoa(max(0, result+rand.IntN(21)-10))
+	})
+}
+
+// captchaEmoji are distinct enough to be told apart at a glance
+var captchaEmoji = []string{"🐶", "🐱", "🦊", "🐻", "🐼", "🐸", "🐵", "🐔", "🐧", "🐙", "🦋", "🐢", "🍎", "🍌", "🍇", "🍓", "🍕", "🚗", "🚀", "⚽", "🎸", "🌵", "🌙", "⭐"}
+
+// emojiVerifier asks to press the button showing a given emoji
+type emojiVerifier struct{}
+
+// NewChallenge creates an emoji grid challenge
+func (emojiVerifier) NewChallenge() core.Challenge {
+	perm := rand.Perm(len(captchaEmoji))
+	answer := captchaEmoji[perm[0]]
+	i := 0
+	return withDecoys(answer, nil, answer, 8, func() string {
+		i++
+		return captchaEmoji[perm[i]]
+	})
+}
+
+// imageVerifier asks to pick the text drawn in a distorted picture
+type imageVerifier struct{}
+
+// captchaAlphabet has no characters that are easily confused with each other
+const captchaAlphabet = "234579ACEFHKMNPRTWXY"
+
+// captchaGlyphs is a 5x7 bitmap font for the alphabet
+var captchaGlyphs = map[rune][7]string{
+	'2': {" ### ", "#   #", "    #", "   # ", "  #  ", " #   ", "#####"},
+	'3': {"#### ", "    #", "    #", " ### ", "    #", "    #", "#### "},
+	'4': {"   # ", "  ## ", " # # ", "#  # ", "#####", "   # ", "   # "},
+	'5': {"#####", "#    ", "#### ", "    #", "    #", "#   #", " ### "},
+	'7': {"#####", "    #", "   # ", "  #  ", " #   ", " #   ", " #   "},
+	'9': {" ### ", "#   #", "#   #", " ####", "    #", "    #", " ### "},
+	'A': {" ### ", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'C': {" ### ", "#   #", "#    ", "#    ", "#    ", "#   #", " ### "},
+	'E': {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#####"},
+	'F': {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#    "},
+	'H': {"#   #", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'K': {"#   #", "#  # ", "# #  ", "##   ", "# #  ", "#  # ", "#   #"},
+	'M': {"#   #", "## ##", "# # #", "# # #", "#   #", "#   #", "#   #"},
+	'N': {"#   #", "##  #", "# # #", "#  ##", "#   #", "#   #", "#   #"},
+	'P': {"#### ", "#   #", "#   #", "#### ", "#    ", "#    ", "#    "},
+	'R': {"#### ", "#   #", "#   #", "#### ", "# #  ", "#  # ", "#   #"},
+	'T': {"#####", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'W': {"#   #", "#   #", "#   #", "# # #", "# # #", "## ##", "#   #"},
+	'X': {"#   #", "#   #", " # # ", "  #  ", " # # ", "#   #", "#   #"},
+	'Y': {"#   #", "#   #", " # # ", "  #  ", "  #  ", "  #  ", "  #  "},
+}
+
+// Picture layout of the image challenge
+const (
+	captchaLength = 5
+	captchaWidth  = 260
+	captchaHeight = 90
+	captchaScale  = 6
+)
+
+// randomCaptchaText returns random characters of the alphabet
+func randomCaptchaText() string {
+	b := make([]byte, captchaLength)
+	for i := range b {
+		b[i] = captchaAlphabet[rand.IntN(len(captchaAlphabet))]
+	}
+	return string(b)
+}
+
+// NewChallenge creates a distorted text challenge, decoys differ from the text in one or two characters
+func (imageVerifier) NewChallenge() core.Challenge {
+	text := randomCaptchaText()
+	return withDecoys("", renderCaptcha(text), text, captchaOptions, func() string {
+		b := []byte(text)
+		for range rand.IntN(2) + 1 {
+			b[rand.IntN(len(b))] = captchaAlphabet[rand.IntN(len(captchaAlphabet))]
+		}
+		return string(b)
+	})
+}
+
+// renderCaptcha draws text with sheared, wavy characters over noise and returns a PNG
+func renderCaptcha(text string) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, captchaWidth, captchaHeight))
+	bg := color.RGBA{uint8(215 + rand.IntN(40)), uint8(215 + rand.IntN(40)), uint8(215 + rand.IntN(40)), 255}
+	for y := range captchaHeight {
+		for x := range captchaWidth {
+			img.Set(x, y, bg)
+		}
+	}
+	randomInk := func() color.RGBA {
+		return color.RGBA{uint8(rand.IntN(120)), uint8(rand.IntN(120)), uint8(rand.IntN(120)), 255}
+	}
+	for range 400 {
+		img.Set(rand.IntN(captchaWidth), rand.IntN(captchaHeight), randomInk())
+	}
+
+	// A wave shared by all characters keeps them from being cut apart by straight lines
+	amp, period, phase := 3+rand.Float64()*3, 18+rand.Float64()*14, rand.Float64()*2*math.Pi
+	wave := func(x int) int { return int(amp * math.Sin(float64(x)/period+phase)) }
+	step := (captchaWidth - 20) / len(text)
+	for i, r := range text {
+		glyph := captchaGlyphs[r]
+		ink := randomInk()
+		shear := rand.Float64()*0.8 - 0.4
+		left := 12 + i*step + rand.IntN(8)
+		top := 10 + rand.IntN(captchaHeight-20-7*captchaScale)
+		for row, line := range glyph {
+			for col, ch := range line {
+				if ch != '#' {
+					continue
+				}
+				for dy := range captchaScale {
+					for dx := range captchaScale {
+						y := top + row*captchaScale + dy
+						x := left + col*captchaScale + dx + int(shear*float64(y-captchaHeight/2))
+						img.Set(x, y+wave(x), ink)
+					}
+				}
+			}
+		}
+	}
+
+	for range 3 {
+		ink := randomInk()
+		x0, y0 := 0.0, float64(rand.IntN(captchaHeight))
+		x1, y1 := float64(captchaWidth), float64(rand.IntN(captchaHeight))
+		for t := 0.0; t <= 1; t += 0.002 {
+			x, y := int(x0+(x1-x0)*t), int(y0+(y1-y0)*t)
+			img.Set(x, y+wave(x), ink)
+			img.Set(x, y+wave(x)+1, ink)
+		}
+	}
+
+	// Encoding into memory can't fail
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// pendingCaptcha is the challenge a user has to answer, Round tells it apart from older ones
+type pendingCaptcha struct {
+	groupID int64
+	method  string
+	round   string
+	answer  int
+	message *tb.Message
+}
+
+// captchaStore keeps pending challenges in memory by group and user, a lost one is replaced by a new challenge
+type captchaStore struct {
+	mu      sync.Mutex
+	pending map[string]*pendingCaptcha
+}
+
+// newCaptchaStore creates an empty store
+func newCaptchaStore() *captchaStore {
+	return &captchaStore{pending: make(map[string]*pendingCaptcha)}
+}
+
+// put sets the challenge of a user in a group
+func (cs *captchaStore) put(groupID, userID int64, p *pendingCaptcha) {
+	cs.mu.Lock()
+	cs.pending[verifyKey(groupID, userID)] = p
+	cs.mu.Unlock()
+}
+
+// take removes and returns the challenge of a user in a group if it is from the given round
+func (cs *captchaStore) take(groupID, userID int64, round string) (pendingCaptcha, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	key := verifyKey(groupID, userID)
+	p, ok := cs.pending[key]
+	if !ok || p.round != round {
+		return pendingCaptcha{}, false
+	}
+	delete(cs.pending, key)
+	return *p, true
+}
+
+// has reports whether a user has a challenge in a group
+func (cs *captchaStore) has(groupID, userID int64) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	_, ok := cs.pending[verifyKey(groupID, userID)]
+	return ok
+}
+
+// drop forgets the challenge of a user in a group
+func (cs *captchaStore) drop(groupID, userID int64) {
+	cs.mu.Lock()
+	delete(cs.pending, verifyKey(groupID, userID))
+	cs.mu.Unlock()
+}
+
+// CaptchaButton returns the generic challenge answer button, the group, round and option are carried in the data
+func CaptchaButton() tb.InlineButton {
+	return tb.InlineButton{Unique: "captcha"}
+}
+
+// captchaQuestion returns the localized question of a challenge
+func captchaQuestion(msgs *i18n.Messages, method string, ch core.Challenge) string {
+	switch method {
+	case core.VerifyArithmetic:
+		return fmt.Sprintf(msgs.Captcha.Arithmetic, ch.Prompt)
+	case core.VerifyEmoji:
+		return fmt.Sprintf(msgs.Captcha.Emoji, ch.Prompt)
+	}
+	return msgs.Captcha.Image
+}
+
+// sendChallenge shows a new challenge of the group's method in a chat, header goes above the question
+func (fh *FeatureHandler) sendChallenge(chat, group *tb.Chat, u *tb.User, method, header string) *tb.Message {
+	lang := fh.getLangForUser(u)
+	msgs := i18n.Get().T(lang)
+
+	ch := verifiers[method].NewChallenge()
+	round := strconv.FormatUint(uint64(rand.Uint32()), 36)
+	btn := CaptchaButton()
+	var rows [][]tb.InlineButton
+	perRow := (len(ch.Options) + 1) / 2
+	for i, option := range ch.Options {
+		if i%perRow == 0 {
+			rows = append(rows, nil)
+		}
+		btn.Text = option
+		btn.Data = ownerData(u.ID, strconv.FormatInt(group.ID, 10)+"|"+round+"|"+strconv.Itoa(i))
+		rows[len(rows)-1] = append(rows[len(rows)-1], btn)
+	}
+	kb := &tb.ReplyMarkup{InlineKeyboard: rows}
+
+	text := captchaQuestion(msgs, method, ch)
+	if header != "" {
+		text = header + "\n\n" + text
+	}
+	var msg *tb.Message
+	var err error
+	if ch.Image != nil {
+		msg, err = fh.bot.Send(chat, &tb.Photo{File: tb.FromReader(bytes.NewReader(ch.Image)), Caption: text}, kb)
+	} else {
+		msg, err = fh.bot.Send(chat, text, kb)
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": chat.ID, "user_id": u.ID}).Error("Failed to send captcha")
+		return nil
+	}
+	fh.captchas.put(group.ID, u.ID, &pendingCaptcha{groupID: group.ID, method: method, round: round, answer: ch.Answer, message: msg})
+	return msg
+}
+
+// replaceChallenge removes an answered challenge and shows a new one, the deadline follows it in the group
+func (fh *FeatureHandler) replaceChallenge(c tb.Context, group *tb.Chat, method, header string) {
+	_ = fh.bot.Delete(c.Message())
+	msg := fh.sendChallenge(c.Chat(), group, c.Sender(), method, header)
+	if msg != nil && c.Chat().ID == group.ID {
+		fh.verify.setMessage(group.ID, c.Sender().ID, msg.ID)
+	}
+}
+
+// HandleCaptchaAnswer checks the pressed option of a challenge
+func (fh *FeatureHandler) HandleCaptchaAnswer(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	cb := c.Callback()
+	if cb == nil {
+		return nil
+	}
+	// A challenge in a private chat names its group in the data, there the chat can't tell it
+	gid, rest, _ := strings.Cut(cb.Data, "|")
+	round, idx, _ := strings.Cut(rest, "|")
+	groupID, err := strconv.ParseInt(gid, 10, 64)
+	if err != nil {
+		return fh.verifyExpired(c)
+	}
+	option, err := strconv.Atoi(idx)
+	if err != nil {
+		return fh.verifyExpired(c)
+	}
+	p, ok := fh.captchas.take(groupID, c.Sender().ID, round)
+	if !ok {
+		// The challenge was lost on restart or replaced, a group welcome gets a new one
+		method := fh.quiz.Policy(c.Chat().ID).Method
+		if _, captcha := verifiers[method]; captcha && c.Chat().Type != tb.ChatPrivate && !fh.captchas.has(c.Chat().ID, c.Sender().ID) {
+			_ = fh.bot.Respond(cb, &tb.CallbackResponse{})
+			fh.replaceChallenge(c, c.Chat(), method, "")
+			return nil
+		}
+		return fh.verifyExpired(c)
+	}
+	group := &tb.Chat{ID: p.groupID, Type: tb.ChatSuperGroup}
+	if c.Chat().ID == group.ID {
+		group = c.Chat()
+	}
+	user := c.Sender()
+	name := fh.adminHandler.GetUserDisplayName(user)
+
+	if option == p.answer {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{})
+		fh.SetUserRestriction(group, user, true)
+		fh.state.ClearNewbie(int(user.ID))
+		fh.state.ClearQuizFails(group.ID, int(user.ID))
+		fh.state.Reset(int(user.ID))
+		fh.verificationDone(group, user)
+		fh.startPremod(user)
+		_ = fh.bot.Delete(c.Message())
+		msg, _ := fh.bot.Send(c.Chat(), msgs.Quiz.VerificationPassed)
+		if c.Chat().Type != tb.ChatPrivate {
+			fh.adminHandler.DeleteAfter(msg, 5*time.Second)
+		}
+		logMsg := fmt.Sprintf("✅ Пользователь прошёл проверку на бота.\n\nПользователь: %s\nСпособ: %s", name, p.method)
+		fh.adminHandler.LogToAdmin(logMsg)
+		fh.adminHandler.Audit(core.AuditCaptchaPassed, nil, user, group.ID, p.method, "")
+		return nil
+	}
+
+	policy := fh.quiz.Policy(group.ID)
+	attempts := fh.state.AddQuizFail(group.ID, int(user.ID), time.Now(), policy.FailTTL)
+	fh.adminHandler.Audit(core.AuditCaptchaFailed, nil, user, group.ID, p.method, fmt.Sprintf("attempt %d/%d", attempts, policy.Attempts))
+	if attempts < policy.Attempts {
+		wrong := fmt.Sprintf(msgs.Captcha.Wrong, policy.Attempts-attempts)
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: wrong})
+		fh.replaceChallenge(c, group, p.method, wrong)
+		return nil
+	}
+
+	// Unlike the quiz a failed CAPTCHA never makes a guest, the user is most likely a bot
+	_ = fh.bot.Respond(cb, &tb.CallbackResponse{})
+	fh.state.ClearNewbie(int(user.ID))
+	fh.state.Reset(int(user.ID))
+	fh.verificationDone(group, user)
+	_ = fh.bot.Delete(c.Message())
+	msg, _ := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Quiz.FailedKicked, name))
+	fh.adminHandler.DeleteAfter(msg, 30*time.Second)
+	if err := fh.kickUser(group, user); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": group.ID, "user_id": user.ID}).Error("Failed to kick user after captcha attempts")
+	}
+	logMsg := fmt.Sprintf("🤖 Пользователь не прошёл проверку на бота и удалён из чата.\n\nПользователь: %s\nСпособ: %s\nПопыток: %d", name, p.method, attempts)
+	fh.logWithActions(logMsg, user, group.ID, "", LogActionBan)
+	return nil
+}
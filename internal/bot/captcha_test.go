@@ -0,0 +1,24 @@
+package bot
+
+import "testing"
+
+func TestCaptchaStorePerGroup(t *testing.T) {
+	cs := newCaptchaStore()
+	cs.put(-100, 1, &pendingCaptcha{groupID: -100, round: "a", answer: 1})
+	cs.put(-200, 1, &pendingCaptcha{groupID: -200, round: "b", answer: 2})
+
+	if _, ok := cs.take(-200, 1, "a"); ok {
+		t.Fatal("round of another group accepted")
+	}
+	p, ok := cs.take(-100, 1, "a")
+	if !ok || p.groupID != -100 || p.answer != 1 {
+		t.Fatalf("first challenge lost: %+v, %v", p, ok)
+	}
+	if !cs.has(-200, 1) || cs.has(-100, 1) {
+		t.Fatal("taking one challenge changed the other group")
+	}
+	cs.drop(-200, 1)
+	if cs.has(-200, 1) {
+		t.Fatal("challenge kept after drop")
+	}
+}
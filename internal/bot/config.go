@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envInt reads an integer tunable from the environment
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name)))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envFloat reads a float tunable from the environment
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv(name)), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envBool reads a boolean tunable from the environment
+func envBool(name string, def bool) bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(name)))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envString reads a string tunable from the environment
+func envString(name, def string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return v
+	}
+	return def
+}
+
+// envDuration reads a duration tunable like 30m, 12h or 7d from the environment
+func envDuration(name string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def
+	}
+	if d, err := parseDuration(v); err == nil {
+		return d
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	return def
+}
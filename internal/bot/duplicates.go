@@ -0,0 +1,335 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+const (
+	maxDupBanLists = 100
+	maxDupPhrase   = 8
+)
+
+// dupSighting is a single message carrying a repeated payload
+type dupSighting struct {
+	chatID int64
+	msgID  int
+	user   tb.User
+	isNew  bool
+	time   time.Time
+}
+
+// dupSender is a sender of a spam wave and the chats they posted it in
+type dupSender struct {
+	user  tb.User
+	chats []int64
+}
+
+// dupCluster groups sightings of the same payload inside the window
+type dupCluster struct {
+	sightings []dupSighting
+	token     string
+}
+
+// dupDetector finds the same payload posted by several new users, or by a new user in several chats
+//
+// Ban list tokens are random, so a button left from before a restart can't point at another wave.
+type dupDetector struct {
+	mu        sync.Mutex
+	clusters  map[string]*dupCluster
+	lastSweep time.Time
+	order     []string
+	banLists  map[string][]dupSender
+
+	enabled    bool
+	window     time.Duration
+	minUsers   int
+	minChats   int
+	minText    int
+	newUserAge time.Duration
+	autoBlack  bool
+}
+
+// newDupDetector creates a duplicate detector configured from the environment
+func newDupDetector() *dupDetector {
+	return &dupDetector{
+		clusters:   make(map[string]*dupCluster),
+		banLists:   make(map[string][]dupSender),
+		enabled:    envBool("DUP_ENABLED", true),
+		window:     envDuration("DUP_WINDOW", 10*time.Minute),
+		minUsers:   envInt("DUP_MIN_USERS", 2),
+		minChats:   envInt("DUP_MIN_CHATS", 2),
+		minText:    envInt("DUP_MIN_TEXT", 20),
+		newUserAge: envDuration("DUP_NEW_USER_AGE", 72*time.Hour),
+		autoBlack:  envBool("DUP_AUTO_BLACKLIST", false),
+	}
+}
+
+// dupPayloadHash returns the hash of a message payload, empty if the message is too trivial to compare
+func (dd *dupDetector) dupPayloadHash(msg *tb.Message) string {
+	var key string
+	if media := messageMediaKey(msg); media != "" {
+		// Popular stickers are reused by everyone
+		if msg.Sticker != nil {
+			return ""
+		}
+		key = media
+	} else {
+		text := normalizeText(msg.Text)
+		if utf8.RuneCountInString(text) < dd.minText {
+			return ""
+		}
+		key = "text:" + text
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// add records a sighting, for a spam wave it returns the ban list token and messages to delete, first is true for a new wave
+func (dd *dupDetector) add(hash string, s dupSighting) (token string, sightings []dupSighting, first bool) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	dd.sweep(s.time)
+
+	cl, ok := dd.clusters[hash]
+	if !ok {
+		cl = &dupCluster{}
+		dd.clusters[hash] = cl
+	}
+	cl.sightings = append(cl.sightings, s)
+	if cl.token != "" {
+		if senders, ok := dd.banLists[cl.token]; ok {
+			dd.banLists[cl.token] = addSender(senders, s)
+		}
+		return cl.token, []dupSighting{s}, false
+	}
+
+	newUsers := make(map[int64]bool)
+	chats := make(map[int64]bool)
+	for _, x := range cl.sightings {
+		if x.isNew {
+			newUsers[x.user.ID] = true
+		}
+		chats[x.chatID] = true
+	}
+	// Established members may cross-post an announcement, a wave needs new senders in either case
+	if len(newUsers) < dd.minUsers && (len(newUsers) == 0 || len(chats) < dd.minChats) {
+		return "", nil, false
+	}
+
+	cl.token = newLogToken()
+	var senders []dupSender
+	for _, x := range cl.sightings {
+		senders = addSender(senders, x)
+	}
+	dd.banLists[cl.token] = senders
+	dd.order = append(dd.order, cl.token)
+	if len(dd.order) > maxDupBanLists {
+		delete(dd.banLists, dd.order[0])
+		dd.order = dd.order[1:]
+	}
+	return cl.token, append([]dupSighting(nil), cl.sightings...), true
+}
+
+// sweep drops sightings older than the window, at most once per minute
+func (dd *dupDetector) sweep(now time.Time) {
+	if now.Sub(dd.lastSweep) < time.Minute {
+		return
+	}
+	dd.lastSweep = now
+	since := now.Add(-dd.window)
+	for hash, cl := range dd.clusters {
+		kept := cl.sightings[:0]
+		for _, x := range cl.sightings {
+			if x.time.After(since) {
+				kept = append(kept, x)
+			}
+		}
+		cl.sightings = kept
+		if len(kept) == 0 {
+			delete(dd.clusters, hash)
+		}
+	}
+}
+
+// takeSenders returns senders to ban for a flagged wave and forgets them, so the list is used only once
+func (dd *dupDetector) takeSenders(token string) ([]dupSender, bool) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	senders, ok := dd.banLists[token]
+	delete(dd.banLists, token)
+	return senders, ok
+}
+
+// addSender adds the sender of a sighting and the chat it was seen in
+func addSender(senders []dupSender, s dupSighting) []dupSender {
+	for i := range senders {
+		if senders[i].user.ID == s.user.ID {
+			if !slices.Contains(senders[i].chats, s.chatID) {
+				senders[i].chats = append(senders[i].chats, s.chatID)
+			}
+			return senders
+		}
+	}
+	return append(senders, dupSender{user: s.user, chats: []int64{s.chatID}})
+}
+
+// normalizeText lowercases text and collapses whitespace
+func normalizeText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// DuplicateBanAllButton returns the button banning all senders of a spam wave
+func DuplicateBanAllButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("dup_banall", msgs.LogActions.BanAll)
+}
+
+// isNewUser reports whether the user joined recently or is still unverified
+func (fh *FeatureHandler) isNewUser(user *tb.User) bool {
+	uid := int(user.ID)
+	if fh.state.IsNewbie(uid) {
+		return true
+	}
+	joined := fh.state.JoinedAt(uid)
+	return !joined.IsZero() && time.Since(joined) < fh.dups.newUserAge
+}
+
+// checkDuplicates deletes messages of a spam wave and alerts admins, returns true if the message was handled
+func (fh *FeatureHandler) checkDuplicates(c tb.Context) bool {
+	if fh.dups == nil || !fh.dups.enabled || fh.adminHandler == nil {
+		return false
+	}
+	msg := c.Message()
+	hash := fh.dups.dupPayloadHash(msg)
+	if hash == "" {
+		return false
+	}
+	sighting := dupSighting{chatID: c.Chat().ID, msgID: msg.ID, user: *msg.Sender, isNew: fh.isNewUser(msg.Sender), time: time.Now()}
+	token, sightings, first := fh.dups.add(hash, sighting)
+	if token == "" {
+		return false
+	}
+
+	deleted := 0
+	for _, s := range sightings {
+		stored := tb.StoredMessage{MessageID: strconv.Itoa(s.msgID), ChatID: s.chatID}
+		if err := fh.bot.Delete(stored); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"chat_id": s.chatID, "message_id": s.msgID}).Debug("Failed to delete duplicate message")
+			continue
+		}
+		deleted++
+	}
+	fh.adminHandler.Audit(core.AuditDuplicate, nil, msg.Sender, c.Chat().ID, "duplicate wave", msg.Text)
+	if !first {
+		logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID}).Info("Deleted another message of a flagged spam wave")
+		return true
+	}
+
+	var names []string
+	users := make(map[int64]bool)
+	chats := make(map[int64]bool)
+	for _, s := range sightings {
+		if !users[s.user.ID] {
+			users[s.user.ID] = true
+			u := s.user
+			names = append(names, fh.adminHandler.GetUserDisplayName(&u))
+		}
+		chats[s.chatID] = true
+	}
+	excerpt := msg.Text
+	if excerpt == "" {
+		excerpt = msg.Caption
+	}
+
+	blacklisted := ""
+	if fh.dups.autoBlack && fh.blacklist != nil {
+		if phrase := dupPhrase(msg.Text); len(phrase) > 0 {
+			fh.blacklist.AddPhrase(phrase)
+			fh.adminHandler.Audit(core.AuditBanWord, nil, nil, c.Chat().ID, "duplicate wave", strings.Join(phrase, " "))
+			blacklisted = "\nВ чёрный список добавлено: " + strings.Join(phrase, " ")
+		}
+	}
+
+	logMsg := fmt.Sprintf("👥 Обнаружена волна одинаковых сообщений.\n\nОтправители (%d): %s\nЧатов: %d\nУдалено сообщений: %d\nСообщение: `%s`%s",
+		len(users), strings.Join(names, ", "), len(chats), deleted, truncate(orDash(excerpt), maxExcerptLen), blacklisted)
+	btn := DuplicateBanAllButton()
+	btn.Data = token
+	fh.adminHandler.LogToAdminWithMarkup(logMsg, &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{btn}}})
+	logrus.WithFields(logrus.Fields{"senders": len(users), "chats": len(chats), "deleted": deleted}).Info("Duplicate spam wave detected")
+	return true
+}
+
+// dupPhrase picks distinct words of a spam text to use as a blacklist phrase
+func dupPhrase(text string) []string {
+	seen := make(map[string]bool)
+	var phrase []string
+	for _, w := range strings.Fields(normalizeText(text)) {
+		if utf8.RuneCountInString(w) < 3 || seen[w] {
+			continue
+		}
+		seen[w] = true
+		phrase = append(phrase, w)
+		if len(phrase) == maxDupPhrase {
+			break
+		}
+	}
+	return phrase
+}
+
+// HandleDuplicateBanAll bans every sender of a flagged spam wave
+func (fh *FeatureHandler) HandleDuplicateBanAll(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	cb := c.Callback()
+	if cb == nil || c.Sender() == nil || c.Message() == nil {
+		return nil
+	}
+	if !fh.adminHandler.IsAdmin(&tb.Chat{ID: fh.adminChatID}, c.Sender()) {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Buttons.NotYourButton})
+		return nil
+	}
+	senders, ok := fh.dups.takeSenders(cb.Data)
+	if !ok {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.LogActions.Expired})
+		return nil
+	}
+
+	banned := 0
+	for _, s := range senders {
+		u := &s.user
+		// Admins of a chat the wave was seen in may cross-post there, they are never banned
+		if slices.ContainsFunc(s.chats, func(id int64) bool { return fh.adminHandler.IsAdmin(&tb.Chat{ID: id}, u) }) {
+			continue
+		}
+		fh.adminHandler.BanUserEverywhere(u, "duplicate wave", "", c.Sender())
+		fh.adminHandler.ClearViolations(u.ID)
+		fh.adminHandler.Audit(core.AuditSpamBan, c.Sender(), u, 0, "duplicate wave", "")
+		banned++
+	}
+
+	adminMsgs := i18n.Get().T(i18n.Get().GetDefault())
+	note := fmt.Sprintf(adminMsgs.LogActions.DoneBy, fmt.Sprintf("%s (%d)", adminMsgs.LogActions.BanAll, banned), fh.adminHandler.GetUserDisplayName(c.Sender()))
+	_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: note})
+	// Editing without markup removes the button
+	if _, err := fh.bot.Edit(c.Message(), c.Message().Text+"\n\n"+note); err != nil {
+		logrus.WithError(err).Warn("Failed to edit duplicate wave log entry")
+	}
+	logrus.WithFields(logrus.Fields{"banned": banned, "admin_id": c.Sender().ID}).Info("Spam wave senders banned")
+	return nil
+}
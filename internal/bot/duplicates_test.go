@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	tb "gopkg.in/telebot.v4"
+)
+
+// newTestDupDetector returns a detector flagging 2 new senders or 2 chats
+func newTestDupDetector() *dupDetector {
+	return &dupDetector{
+		clusters: make(map[string]*dupCluster),
+		banLists: make(map[string][]dupSender),
+		enabled:  true,
+		window:   10 * time.Minute,
+		minUsers: 2,
+		minChats: 2,
+	}
+}
+
+func TestDupNewUsers(t *testing.T) {
+	dd := newTestDupDetector()
+	now := time.Now()
+	if token, _, _ := dd.add("h", dupSighting{chatID: 1, msgID: 1, user: tb.User{ID: 10}, isNew: true, time: now}); token != "" {
+		t.Fatal("a single sighting flagged")
+	}
+	token, sightings, first := dd.add("h", dupSighting{chatID: 1, msgID: 2, user: tb.User{ID: 11}, isNew: true, time: now})
+	if token == "" || !first || len(sightings) != 2 {
+		t.Fatalf("two new senders not flagged: %q, %d, %v", token, len(sightings), first)
+	}
+	if again, sightings, first := dd.add("h", dupSighting{chatID: 1, msgID: 3, user: tb.User{ID: 12}, time: now}); again != token || first || len(sightings) != 1 {
+		t.Fatalf("later sighting of the wave: %q, %d, %v", again, len(sightings), first)
+	}
+	if senders, ok := dd.takeSenders(token); !ok || len(senders) != 3 {
+		t.Fatalf("ban list: %v, %v", senders, ok)
+	}
+	if _, ok := dd.takeSenders(token); ok {
+		t.Fatal("ban list used twice")
+	}
+}
+
+func TestDupCrossPost(t *testing.T) {
+	dd := newTestDupDetector()
+	now := time.Now()
+	dd.add("h", dupSighting{chatID: 1, msgID: 1, user: tb.User{ID: 10}, time: now})
+	if token, _, _ := dd.add("h", dupSighting{chatID: 2, msgID: 1, user: tb.User{ID: 10}, time: now}); token != "" {
+		t.Fatal("an established member's announcement in two chats flagged")
+	}
+
+	dd.add("n", dupSighting{chatID: 1, msgID: 2, user: tb.User{ID: 20}, isNew: true, time: now})
+	token, _, _ := dd.add("n", dupSighting{chatID: 2, msgID: 2, user: tb.User{ID: 20}, isNew: true, time: now})
+	if token == "" {
+		t.Fatal("a new user posting in two chats not flagged")
+	}
+	senders, _ := dd.takeSenders(token)
+	if len(senders) != 1 || len(senders[0].chats) != 2 {
+		t.Fatalf("source chats of the sender not kept: %+v", senders)
+	}
+}
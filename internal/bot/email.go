@@ -0,0 +1,316 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// emailSession is an e-mail verification in progress, the address itself is never kept
+type emailSession struct {
+	groupID  int64
+	hash     string
+	domain   string
+	code     string
+	expires  time.Time
+	attempts int
+}
+
+// emailVerifier sends one-time codes and remembers salted hashes of verified addresses in a JSON file in data/
+type emailVerifier struct {
+	mu       sync.Mutex
+	Salt     string           `json:"salt"`
+	Verified map[string]int64 `json:"verified"`
+	sessions map[int64]*emailSession
+	sends    map[int64][]time.Time
+	file     string
+	mailer   core.Mailer
+	domains  []string
+	ttl      time.Duration
+	attempts int
+	maxSends int
+}
+
+// newEmailVerifier creates the verifier configured from the environment
+func newEmailVerifier(file string, mailer core.Mailer) *emailVerifier {
+	_ = os.MkdirAll("data", 0755)
+	if !strings.HasPrefix(file, "data/") {
+		file = "data/" + file
+	}
+	ev := &emailVerifier{
+		Verified: make(map[string]int64),
+		sessions: make(map[int64]*emailSession),
+		sends:    make(map[int64][]time.Time),
+		file:     file,
+		mailer:   mailer,
+		ttl:      envDuration("EMAIL_CODE_TTL", 15*time.Minute),
+		attempts: envInt("EMAIL_CODE_ATTEMPTS", 5),
+		maxSends: envInt("EMAIL_MAX_SENDS", 3),
+	}
+	for _, d := range strings.Split(envString("EMAIL_DOMAINS", "ue.poznan.pl,student.ue.poznan.pl"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			ev.domains = append(ev.domains, d)
+		}
+	}
+	ev.load()
+	if ev.Salt == "" {
+		salt := make([]byte, 32)
+		_, _ = rand.Read(salt)
+		ev.Salt = hex.EncodeToString(salt)
+		ev.save()
+	}
+	return ev
+}
+
+// normalizeAddress checks the address format and the domain allowlist
+func (ev *emailVerifier) normalizeAddress(text string) (addr, domain string, ok bool) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(text))
+	if err != nil || parsed.Name != "" {
+		return "", "", false
+	}
+	addr = strings.ToLower(parsed.Address)
+	_, domain, _ = strings.Cut(addr, "@")
+	for _, d := range ev.domains {
+		if domain == d {
+			return addr, domain, true
+		}
+	}
+	return "", "", false
+}
+
+// hash returns the salted hash of an address
+func (ev *emailVerifier) hash(addr string) string {
+	mac := hmac.New(sha256.New, []byte(ev.Salt))
+	mac.Write([]byte(addr))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// begin waits for the user's address
+func (ev *emailVerifier) begin(userID, groupID int64) {
+	ev.mu.Lock()
+	ev.sessions[userID] = &emailSession{groupID: groupID}
+	ev.mu.Unlock()
+}
+
+// session returns a copy of the user's session
+func (ev *emailVerifier) session(userID int64) (emailSession, bool) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	s, ok := ev.sessions[userID]
+	if !ok {
+		return emailSession{}, false
+	}
+	return *s, true
+}
+
+// usedBy returns the user verified with an address hash
+func (ev *emailVerifier) usedBy(hash string) (int64, bool) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	id, ok := ev.Verified[hash]
+	return id, ok
+}
+
+// allowSend counts a code sent to the user, returns false if the hourly limit is reached
+func (ev *emailVerifier) allowSend(userID int64, now time.Time) bool {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	kept := ev.sends[userID][:0]
+	for _, t := range ev.sends[userID] {
+		if now.Sub(t) < time.Hour {
+			kept = append(kept, t)
+		}
+	}
+	if ev.maxSends > 0 && len(kept) >= ev.maxSends {
+		ev.sends[userID] = kept
+		return false
+	}
+	ev.sends[userID] = append(kept, now)
+	return true
+}
+
+// setCode starts waiting for a code sent to an address
+func (ev *emailVerifier) setCode(userID int64, hash, domain, code string, now time.Time) {
+	ev.mu.Lock()
+	if s, ok := ev.sessions[userID]; ok {
+		s.hash, s.domain, s.code, s.expires, s.attempts = hash, domain, code, now.Add(ev.ttl), ev.attempts
+	}
+	ev.mu.Unlock()
+}
+
+// checkCode compares a code, returns the session on success and the attempts left otherwise
+func (ev *emailVerifier) checkCode(userID int64, code string, now time.Time) (emailSession, int, bool) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	s, ok := ev.sessions[userID]
+	if !ok || s.code == "" {
+		return emailSession{}, 0, false
+	}
+	if now.After(s.expires) || s.attempts <= 0 {
+		s.code = ""
+		return emailSession{}, 0, false
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(s.code)) != 1 {
+		s.attempts--
+		if s.attempts <= 0 {
+			s.code = ""
+		}
+		return emailSession{}, s.attempts, false
+	}
+	done := *s
+	delete(ev.sessions, userID)
+	return done, 0, true
+}
+
+// markVerified remembers the address hash of a verified user
+func (ev *emailVerifier) markVerified(hash string, userID int64) {
+	ev.mu.Lock()
+	ev.Verified[hash] = userID
+	ev.mu.Unlock()
+	ev.save()
+}
+
+// end drops the user's session
+func (ev *emailVerifier) end(userID int64) {
+	ev.mu.Lock()
+	delete(ev.sessions, userID)
+	ev.mu.Unlock()
+}
+
+// save persists the salt and verified hashes to disk
+func (ev *emailVerifier) save() {
+	ev.mu.Lock()
+	data, err := json.MarshalIndent(ev, "", "  ")
+	ev.mu.Unlock()
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(ev.file, data, 0600)
+}
+
+// load reads the salt and verified hashes from disk
+func (ev *emailVerifier) load() {
+	data, err := os.ReadFile(ev.file)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, ev)
+	if ev.Verified == nil {
+		ev.Verified = make(map[string]int64)
+	}
+}
+
+// newEmailCode returns a random six-digit code
+func newEmailCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// startEmailVerification asks the user for their university address
+func (fh *FeatureHandler) startEmailVerification(c tb.Context, group *tb.Chat) {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	fh.email.begin(c.Sender().ID, group.ID)
+	_ = fh.SendOrEdit(c.Chat(), c.Message(), fmt.Sprintf(msgs.Email.AskAddress, strings.Join(fh.email.domains, ", ")), nil)
+}
+
+// handleEmailInput takes an address or a code in the private chat, returns false if the user isn't verifying by e-mail
+func (fh *FeatureHandler) handleEmailInput(c tb.Context) bool {
+	if fh.email == nil || c.Sender() == nil {
+		return false
+	}
+	s, ok := fh.email.session(c.Sender().ID)
+	if !ok {
+		return false
+	}
+	if !fh.state.IsNewbie(int(c.Sender().ID)) {
+		fh.email.end(c.Sender().ID)
+		return false
+	}
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	text := strings.TrimSpace(c.Message().Text)
+	if s.code == "" || strings.Contains(text, "@") {
+		fh.sendEmailCode(c, text)
+		return true
+	}
+
+	done, left, ok := fh.email.checkCode(c.Sender().ID, text, time.Now())
+	if !ok {
+		reply := msgs.Email.CodeExpired
+		if left > 0 {
+			reply = fmt.Sprintf(msgs.Email.WrongCode, left)
+		}
+		_, _ = fh.bot.Send(c.Chat(), reply)
+		return true
+	}
+
+	group := &tb.Chat{ID: done.groupID, Type: tb.ChatSuperGroup}
+	fh.email.markVerified(done.hash, c.Sender().ID)
+	fh.SetUserRestriction(group, c.Sender(), true)
+	fh.state.ClearNewbie(int(c.Sender().ID))
+	fh.state.Reset(int(c.Sender().ID))
+	fh.verificationDone(group, c.Sender())
+	fh.startPremod(c.Sender())
+	_, _ = fh.bot.Send(c.Chat(), msgs.Quiz.VerificationPassed)
+
+	fh.adminHandler.Audit(core.AuditEmailVerified, nil, c.Sender(), group.ID, "email", done.domain)
+	logMsg := fmt.Sprintf("📧 Пользователь подтвердил университетскую почту.\n\nПользователь: %s\nДомен: %s", fh.adminHandler.GetUserDisplayName(c.Sender()), done.domain)
+	fh.adminHandler.LogToAdmin(logMsg)
+	logrus.WithFields(logrus.Fields{"user_id": c.Sender().ID, "chat_id": group.ID}).Info("User verified by e-mail")
+	return true
+}
+
+// sendEmailCode validates an address and mails a one-time code to it
+func (fh *FeatureHandler) sendEmailCode(c tb.Context, text string) {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	addr, domain, ok := fh.email.normalizeAddress(text)
+	if !ok {
+		_, _ = fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Email.BadAddress, strings.Join(fh.email.domains, ", ")))
+		return
+	}
+	hash := fh.email.hash(addr)
+	if id, used := fh.email.usedBy(hash); used && id != c.Sender().ID {
+		_, _ = fh.bot.Send(c.Chat(), msgs.Email.AlreadyUsed)
+		return
+	}
+	if !fh.email.allowSend(c.Sender().ID, time.Now()) {
+		_, _ = fh.bot.Send(c.Chat(), msgs.Email.TooManySends)
+		return
+	}
+	code, err := newEmailCode()
+	if err == nil {
+		err = fh.email.mailer.Send(addr, msgs.Email.Subject, fmt.Sprintf(msgs.Email.Body, code))
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", c.Sender().ID).Error("Failed to send verification e-mail")
+		_, _ = fh.bot.Send(c.Chat(), msgs.Email.SendFailed)
+		return
+	}
+	fh.email.setCode(c.Sender().ID, hash, domain, code, time.Now())
+	_, _ = fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Email.CodeSent, int(fh.email.ttl.Minutes())))
+	logrus.WithFields(logrus.Fields{"user_id": c.Sender().ID, "domain": domain}).Info("Verification code sent")
+}
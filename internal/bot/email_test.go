@@ -0,0 +1,204 @@
+package bot
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMessage is a message received by the test SMTP listener
+type smtpMessage struct {
+	to   string
+	data string
+}
+
+// newTestSMTP starts a minimal SMTP listener and returns its address and the received messages
+func newTestSMTP(t *testing.T) (string, <-chan smtpMessage) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan smtpMessage, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost")
+		var msg smtpMessage
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"), strings.HasPrefix(cmd, "MAIL"):
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT"):
+				msg.to = strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var b strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					b.WriteString(l)
+				}
+				msg.data = b.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 bye")
+				received <- msg
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+// newTestEmailVerifier creates a verifier writing to a temporary data directory
+func newTestEmailVerifier(t *testing.T, addr string) *emailVerifier {
+	t.Chdir(t.TempDir())
+	t.Setenv("EMAIL_DOMAINS", "ue.poznan.pl, Student.UE.poznan.pl")
+	t.Setenv("EMAIL_CODE_TTL", "15m")
+	t.Setenv("EMAIL_CODE_ATTEMPTS", "3")
+	return newEmailVerifier("email.json", NewSMTPMailer(addr, "", "", "bot@localhost"))
+}
+
+func TestEmailAllowlist(t *testing.T) {
+	ev := newTestEmailVerifier(t, "127.0.0.1:0")
+	tests := map[string]bool{
+		"jan.kowalski@ue.poznan.pl":          true,
+		" Jan@STUDENT.ue.poznan.pl ":         true,
+		"jan@gmail.com":                      false,
+		"jan@evil-ue.poznan.pl":              false,
+		"jan@ue.poznan.pl.evil.com":          false,
+		"Jan Kowalski <jan@ue.poznan.pl>":    false,
+		"not an address":                     false,
+		"jan@ue.poznan.pl, bob@ue.poznan.pl": false,
+	}
+	for text, want := range tests {
+		if _, _, ok := ev.normalizeAddress(text); ok != want {
+			t.Errorf("normalizeAddress(%q) = %v, want %v", text, ok, want)
+		}
+	}
+	addr, domain, _ := ev.normalizeAddress(" Jan@STUDENT.ue.poznan.pl ")
+	if addr != "jan@student.ue.poznan.pl" || domain != "student.ue.poznan.pl" {
+		t.Errorf("address not normalized: %q, %q", addr, domain)
+	}
+}
+
+func TestEmailSendCode(t *testing.T) {
+	smtpAddr, received := newTestSMTP(t)
+	ev := newTestEmailVerifier(t, smtpAddr)
+
+	code, err := newEmailCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ev.mailer.Send("jan@ue.poznan.pl", "Kod weryfikacyjny", "Twój kod: "+code); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg.to != "jan@ue.poznan.pl" {
+			t.Errorf("recipient %q", msg.to)
+		}
+		_, body, _ := strings.Cut(msg.data, "\r\n\r\n")
+		if got := regexp.MustCompile(`\b\d{6}\b`).FindString(body); got != code {
+			t.Errorf("code %q not in the message:\n%s", code, msg.data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	if err := ev.mailer.Send("jan@ue.poznan.pl\r\nBcc: x@y.z", "s", "b"); err == nil {
+		t.Error("header injection accepted")
+	}
+}
+
+func TestEmailWrongCode(t *testing.T) {
+	ev := newTestEmailVerifier(t, "127.0.0.1:0")
+	now := time.Now()
+	ev.begin(1, -100)
+	ev.setCode(1, ev.hash("jan@ue.poznan.pl"), "ue.poznan.pl", "123456", now)
+
+	for want := 2; want >= 1; want-- {
+		if _, left, ok := ev.checkCode(1, "000000", now); ok || left != want {
+			t.Fatalf("wrong code: ok %v, %d attempts left, want %d", ok, left, want)
+		}
+	}
+	if _, left, ok := ev.checkCode(1, "000000", now); ok || left != 0 {
+		t.Fatalf("last attempt: ok %v, %d left", ok, left)
+	}
+	if _, _, ok := ev.checkCode(1, "123456", now); ok {
+		t.Fatal("right code accepted after the attempts ran out")
+	}
+}
+
+func TestEmailCodeExpiry(t *testing.T) {
+	ev := newTestEmailVerifier(t, "127.0.0.1:0")
+	now := time.Now()
+	ev.begin(1, -100)
+	ev.setCode(1, ev.hash("jan@ue.poznan.pl"), "ue.poznan.pl", "123456", now)
+	if _, _, ok := ev.checkCode(1, "123456", now.Add(16*time.Minute)); ok {
+		t.Fatal("expired code accepted")
+	}
+
+	ev.begin(2, -100)
+	ev.setCode(2, ev.hash("ola@ue.poznan.pl"), "ue.poznan.pl", "654321", now)
+	s, _, ok := ev.checkCode(2, "654321", now.Add(14*time.Minute))
+	if !ok || s.groupID != -100 || s.domain != "ue.poznan.pl" {
+		t.Fatalf("valid code rejected: %+v, %v", s, ok)
+	}
+	if _, ok := ev.session(2); ok {
+		t.Error("session kept after verification")
+	}
+}
+
+func TestEmailStoresOnlySaltedHash(t *testing.T) {
+	ev := newTestEmailVerifier(t, "127.0.0.1:0")
+	addr := "jan.kowalski@ue.poznan.pl"
+	hash := ev.hash(addr)
+	ev.markVerified(hash, 1)
+
+	data, err := os.ReadFile("data/email.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{addr, "jan.kowalski", "ue.poznan.pl"} {
+		if strings.Contains(string(data), leak) {
+			t.Errorf("%q persisted:\n%s", leak, data)
+		}
+	}
+	if !strings.Contains(string(data), hash) {
+		t.Errorf("hash not persisted:\n%s", data)
+	}
+
+	reloaded := newEmailVerifier("email.json", nil)
+	if id, ok := reloaded.usedBy(hash); !ok || id != 1 {
+		t.Errorf("verified hash not reloaded: %d, %v", id, ok)
+	}
+
+	// Another installation with its own salt gets a different hash for the same address
+	other := newTestEmailVerifier(t, "127.0.0.1:0")
+	if other.Salt == ev.Salt || other.hash(addr) == hash {
+		t.Error("hash doesn't depend on the salt")
+	}
+}
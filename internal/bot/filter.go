@@ -1,8 +1,10 @@
 package bot
 
 import (
+	"UEPB/internal/core"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	tb "gopkg.in/telebot.v4"
@@ -30,6 +32,20 @@ func (fh *FeatureHandler) FilterMessage(c tb.Context) error {
 		return nil
 	}
 
+	// Locked content, flood and spam waves are handled before content filters
+	if fh.checkLocks(c) {
+		return nil
+	}
+	if fh.checkFlood(c) {
+		return nil
+	}
+	if fh.checkDuplicates(c) {
+		return nil
+	}
+	if fh.checkHidden(c) {
+		return nil
+	}
+
 	// Debug log
 	logrus.WithFields(logrus.Fields{
 		"chat_id": c.Chat().ID,
@@ -37,10 +53,16 @@ func (fh *FeatureHandler) FilterMessage(c tb.Context) error {
 		"message": msg.Text,
 	}).Debug("Filtering message")
 
-	if fh.blacklist != nil && fh.blacklist.CheckMessage(msg.Text) {
+	var phrase []string
+	matched := false
+	if fh.blacklist != nil {
+		phrase, matched = fh.blacklist.Match(msg.Text)
+	}
+	if matched {
 		// Record violation
 		if fh.adminHandler != nil {
-			fh.adminHandler.AddViolation(msg.Sender.ID)
+			fh.adminHandler.AddViolation(msg.Sender.ID, c.Chat().ID, "blacklist: "+strings.Join(phrase, " "), msg.Text)
+			fh.adminHandler.Audit(core.AuditViolation, nil, msg.Sender, c.Chat().ID, "blacklist: "+strings.Join(phrase, " "), msg.Text)
 		}
 		violationCount := 0
 		if fh.adminHandler != nil {
@@ -71,8 +93,11 @@ func (fh *FeatureHandler) FilterMessage(c tb.Context) error {
 						"user_id": msg.Sender.ID,
 					}).Error("Failed to ban user for repeated violations")
 				} else {
+					fh.adminHandler.RecordBan(msg.Sender, c.Chat().ID, "blacklist: "+strings.Join(phrase, " "), msg.Text, nil)
 					fh.adminHandler.ClearViolations(msg.Sender.ID)
-					banLog := fmt.Sprintf("🔨 Выдан бан за спам.\n\nЗабанен: %s\nНарушений: %d", fh.adminHandler.GetUserDisplayName(msg.Sender), violationCount)
+					fh.adminHandler.Audit(core.AuditAutoBan, nil, msg.Sender, c.Chat().ID, "blacklist: "+strings.Join(phrase, " "), msg.Text)
+					purged := fh.adminHandler.PurgeUserMessages(msg.Sender.ID)
+					banLog := fmt.Sprintf("🔨 Выдан бан за спам.\n\nЗабанен: %s\nНарушений: %d\nУдалено сообщений: %d", fh.adminHandler.GetUserDisplayName(msg.Sender), violationCount, purged)
 					fh.adminHandler.LogToAdmin(banLog)
 					logrus.WithFields(logrus.Fields{"user_id": msg.Sender.ID, "violations": violationCount}).Info("User banned after violations")
 				}
@@ -82,8 +107,64 @@ func (fh *FeatureHandler) FilterMessage(c tb.Context) error {
 
 		if fh.adminHandler != nil {
 			logMsg := fmt.Sprintf("⚠️ Обнаружено нарушение.\n\nПользователь: %s\nНарушение: #%d\nСообщение: `%s`", fh.adminHandler.GetUserDisplayName(msg.Sender), violationCount, msg.Text)
-			fh.adminHandler.LogToAdmin(logMsg)
+			fh.logWithActions(logMsg, msg.Sender, c.Chat().ID, msg.Text, LogActionBan, LogActionForgive, LogActionBlacklist)
 		}
+		return nil
+	}
+
+	if fh.holdForPremod(c) {
+		return nil
+	}
+	if fh.checkClassifier(c) {
+		return nil
 	}
+	fh.trainHam(c)
 	return nil
 }
+
+// checkClassifier flags or deletes messages scored as spam, returns true if the message was acted on
+func (fh *FeatureHandler) checkClassifier(c tb.Context) bool {
+	msg := c.Message()
+	if fh.classifier == nil || fh.adminHandler == nil {
+		return false
+	}
+	score, ok := fh.classifier.Score(msg.Text)
+	if !ok || score < fh.bayesFlag {
+		return false
+	}
+	rule := fmt.Sprintf("bayes: %.2f", score)
+	name := fh.adminHandler.GetUserDisplayName(msg.Sender)
+
+	if score < fh.bayesDelete {
+		logMsg := fmt.Sprintf("🤖 Классификатор считает сообщение спамом.\n\nПользователь: %s\nВероятность: %.2f\nСообщение: `%s`", name, score, msg.Text)
+		fh.logWithActions(logMsg, msg.Sender, c.Chat().ID, msg.Text, LogActionBan, LogActionForgive)
+		logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID, "score": score}).Info("Message flagged by classifier")
+		return true
+	}
+
+	if err := fh.bot.Delete(msg); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": c.Chat().ID, "message_id": msg.ID}).Warn("Failed to delete classified spam")
+	}
+	fh.adminHandler.AddViolation(msg.Sender.ID, c.Chat().ID, rule, msg.Text)
+	fh.adminHandler.Audit(core.AuditViolation, nil, msg.Sender, c.Chat().ID, rule, msg.Text)
+	logMsg := fmt.Sprintf("🤖 Классификатор удалил спам.\n\nПользователь: %s\nВероятность: %.2f\nНарушений: %d\nСообщение: `%s`", name, score, fh.adminHandler.GetViolations(msg.Sender.ID), msg.Text)
+	fh.logWithActions(logMsg, msg.Sender, c.Chat().ID, msg.Text, LogActionBan, LogActionForgive)
+	logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID, "score": score}).Info("Message deleted by classifier")
+	return true
+}
+
+// trainHam feeds ordinary messages of long-verified members to the classifier
+func (fh *FeatureHandler) trainHam(c tb.Context) {
+	if fh.classifier == nil {
+		return
+	}
+	uid := int(c.Message().Sender.ID)
+	if fh.state.IsNewbie(uid) || fh.state.IsPremod(uid) {
+		return
+	}
+	// Without a known join time there is no telling how long the member has been trusted
+	if joined := fh.state.JoinedAt(uid); joined.IsZero() || time.Since(joined) < fh.bayesHamAge {
+		return
+	}
+	fh.classifier.Train(c.Message().Text, false)
+}
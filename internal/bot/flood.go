@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+const (
+	floodReasonRate      = "rate"
+	floodReasonIdentical = "identical"
+	floodReasonLines     = "lines"
+
+	// floodShortLine is the maximum length of a line counted as short
+	floodShortLine = 10
+
+	// floodPruneInterval is how often users who stopped writing are forgotten
+	floodPruneInterval = time.Minute
+)
+
+// floodEntry is a single recent message of a user
+type floodEntry struct {
+	time time.Time
+	key  string
+}
+
+// floodDetector keeps recent messages per chat and user in memory, along with the window last used in each chat
+type floodDetector struct {
+	mu        sync.Mutex
+	chats     map[int64]map[int64][]floodEntry
+	windows   map[int64]time.Duration
+	lastPrune time.Time
+}
+
+// newFloodDetector creates an empty flood detector
+func newFloodDetector() *floodDetector {
+	return &floodDetector{chats: make(map[int64]map[int64][]floodEntry), windows: make(map[int64]time.Duration)}
+}
+
+// prune drops messages that left the window of their chat and users without recent messages, the caller holds the lock
+func (fd *floodDetector) prune(now time.Time) {
+	fd.lastPrune = now
+	for chatID, users := range fd.chats {
+		since := now.Add(-fd.windows[chatID])
+		for userID, entries := range users {
+			if len(entries) == 0 || !entries[len(entries)-1].time.After(since) {
+				delete(users, userID)
+			}
+		}
+		if len(users) == 0 {
+			delete(fd.chats, chatID)
+			delete(fd.windows, chatID)
+		}
+	}
+}
+
+// check remembers a message and returns the reason if the user is flooding
+func (fd *floodDetector) check(chatID, userID int64, msg *tb.Message, fs core.FloodSettings, now time.Time) (string, bool) {
+	if fs.MaxLines > 0 && shortLines(msg.Text) >= fs.MaxLines {
+		return floodReasonLines, true
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if now.Sub(fd.lastPrune) >= floodPruneInterval {
+		fd.prune(now)
+	}
+	users, ok := fd.chats[chatID]
+	if !ok {
+		users = make(map[int64][]floodEntry)
+		fd.chats[chatID] = users
+	}
+	window := time.Duration(fs.WindowSec) * time.Second
+	fd.windows[chatID] = window
+	since := now.Add(-window)
+	kept := users[userID][:0]
+	for _, e := range users[userID] {
+		if e.time.After(since) {
+			kept = append(kept, e)
+		}
+	}
+	key := messageContentKey(msg)
+	kept = append(kept, floodEntry{time: now, key: key})
+	users[userID] = kept
+
+	if fs.MaxMessages > 0 && len(kept) >= fs.MaxMessages {
+		return floodReasonRate, true
+	}
+	if fs.MaxIdentical > 0 && key != "" {
+		same := 0
+		for _, e := range kept {
+			if e.key == key {
+				same++
+			}
+		}
+		if same >= fs.MaxIdentical {
+			return floodReasonIdentical, true
+		}
+	}
+	return "", false
+}
+
+// reset forgets recent messages of a user in a chat
+func (fd *floodDetector) reset(chatID, userID int64) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	delete(fd.chats[chatID], userID)
+}
+
+// migrate moves recent messages of a chat to its new ID
+func (fd *floodDetector) migrate(from, to int64) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if users, ok := fd.chats[from]; ok {
+		fd.chats[to] = users
+		fd.windows[to] = fd.windows[from]
+		delete(fd.chats, from)
+		delete(fd.windows, from)
+	}
+}
+
+// messageMediaKey returns the unique file ID of attached media, the same sticker or photo always has the same key
+func messageMediaKey(msg *tb.Message) string {
+	media := msg.Media()
+	if media == nil || media.MediaFile() == nil || media.MediaFile().UniqueID == "" {
+		return ""
+	}
+	return media.MediaType() + ":" + media.MediaFile().UniqueID
+}
+
+// messageContentKey returns a key identifying message content, media first and normalized text otherwise
+func messageContentKey(msg *tb.Message) string {
+	if key := messageMediaKey(msg); key != "" {
+		return key
+	}
+	text := normalizeText(msg.Text)
+	if text == "" {
+		return ""
+	}
+	return "text:" + text
+}
+
+// shortLines counts short lines of a text
+func shortLines(text string) int {
+	if !strings.Contains(text, "\n") {
+		return 0
+	}
+	n := 0
+	for _, line := range strings.Split(text, "\n") {
+		if utf8.RuneCountInString(strings.TrimSpace(line)) <= floodShortLine {
+			n++
+		}
+	}
+	return n
+}
+
+// floodReasonText returns the admin log description of a flood reason
+func floodReasonText(reason string) string {
+	switch reason {
+	case floodReasonRate:
+		return "слишком много сообщений"
+	case floodReasonIdentical:
+		return "повтор одинаковых сообщений или стикеров"
+	case floodReasonLines:
+		return "много коротких строк в одном сообщении"
+	}
+	return reason
+}
+
+// checkFlood mutes the sender if the message exceeds chat flood thresholds, returns true if the message was handled
+func (fh *FeatureHandler) checkFlood(c tb.Context) bool {
+	// Muting is meaningless in a private chat with the bot
+	if fh.settings == nil || fh.adminHandler == nil || c.Chat().Type == tb.ChatPrivate {
+		return false
+	}
+	msg := c.Message()
+	fs := fh.settings.Get(c.Chat().ID).Flood
+	if fs.Disabled {
+		return false
+	}
+	reason, flooded := fh.flood.check(c.Chat().ID, msg.Sender.ID, msg, fs, time.Now())
+	if !flooded {
+		return false
+	}
+	fh.flood.reset(c.Chat().ID, msg.Sender.ID)
+
+	if err := fh.bot.Delete(msg); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID}).Warn("Failed to delete flood message")
+	}
+	// Telegram treats a restriction ending within a minute as permanent
+	until := fh.adminHandler.MuteUser(c.Chat(), msg.Sender, time.Duration(max(fs.MuteMinutes, 1))*time.Minute)
+	untilStr := until.Format("2006-01-02 15:04")
+	fh.adminHandler.Audit(core.AuditFloodMute, nil, msg.Sender, c.Chat().ID, "flood: "+reason, "until "+untilStr)
+
+	lang := fh.getLangForUser(msg.Sender)
+	msgs := i18n.Get().T(lang)
+	notice, _ := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Flood.Muted, fh.adminHandler.GetUserDisplayName(msg.Sender), untilStr))
+	fh.adminHandler.DeleteAfter(notice, 30*time.Second)
+
+	logMsg := fmt.Sprintf("🌊 Флуд: пользователь замучен.\n\nПользователь: %s\nЧат: %s\nПричина: %s\nДо: %s", fh.adminHandler.GetUserDisplayName(msg.Sender), c.Chat().Title, floodReasonText(reason), untilStr)
+	fh.logWithActions(logMsg, msg.Sender, c.Chat().ID, "", LogActionUnrestrict, LogActionBan)
+	logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID, "reason": reason}).Info("User muted for flood")
+	return true
+}
+
+// HandleFlood shows or changes flood thresholds of a chat: /flood [on|off|rate 8 10|identical 3|lines 20|mute 30m]
+func (fh *FeatureHandler) HandleFlood(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if c.Message() == nil || c.Sender() == nil || c.Chat().Type == tb.ChatPrivate || c.Chat().ID == fh.adminChatID || !fh.adminHandler.IsAdmin(c.Chat(), c.Sender()) {
+		msg, _ := fh.bot.Send(c.Chat(), msgs.Flood.CommandAdminOnly)
+		fh.adminHandler.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+
+	args := c.Args()
+	if len(args) > 0 {
+		if !fh.updateFloodSettings(c.Chat().ID, args) {
+			msg, _ := fh.bot.Send(c.Chat(), msgs.Flood.Usage)
+			fh.adminHandler.DeleteAfter(msg, 10*time.Second)
+			return nil
+		}
+		logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "admin_id": c.Sender().ID, "args": strings.Join(args, " ")}).Info("Flood settings updated")
+	}
+
+	fs := fh.settings.Get(c.Chat().ID).Flood
+	state := msgs.Flood.On
+	if fs.Disabled {
+		state = msgs.Flood.Off
+	}
+	_, err := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Flood.Status, state, fs.MaxMessages, fs.WindowSec, fs.MaxIdentical, fs.MaxLines, fs.MuteMinutes))
+	return err
+}
+
+// updateFloodSettings applies /flood arguments, returns false on invalid input
+func (fh *FeatureHandler) updateFloodSettings(chatID int64, args []string) bool {
+	num := func(i int) (int, bool) {
+		if i >= len(args) {
+			return 0, false
+		}
+		n, err := strconv.Atoi(args[i])
+		return n, err == nil && n >= 0
+	}
+
+	var apply func(fs *core.FloodSettings)
+	switch strings.ToLower(args[0]) {
+	case "on":
+		apply = func(fs *core.FloodSettings) { fs.Disabled = false }
+	case "off":
+		apply = func(fs *core.FloodSettings) { fs.Disabled = true }
+	case "rate":
+		count, ok1 := num(1)
+		sec, ok2 := num(2)
+		if !ok1 || !ok2 || sec == 0 {
+			return false
+		}
+		apply = func(fs *core.FloodSettings) { fs.MaxMessages, fs.WindowSec = count, sec }
+	case "identical":
+		n, ok := num(1)
+		if !ok {
+			return false
+		}
+		apply = func(fs *core.FloodSettings) { fs.MaxIdentical = n }
+	case "lines":
+		n, ok := num(1)
+		if !ok {
+			return false
+		}
+		apply = func(fs *core.FloodSettings) { fs.MaxLines = n }
+	case "mute":
+		if len(args) < 2 {
+			return false
+		}
+		d, err := parseDuration(args[1])
+		if err != nil || d < time.Minute {
+			return false
+		}
+		apply = func(fs *core.FloodSettings) { fs.MuteMinutes = int(d / time.Minute) }
+	default:
+		return false
+	}
+	fh.settings.Update(chatID, func(cs *core.ChatSettings) { apply(&cs.Flood) })
+	return true
+}
@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"UEPB/internal/core"
+
+	tb "gopkg.in/telebot.v4"
+)
+
+func TestFloodRate(t *testing.T) {
+	fd := newFloodDetector()
+	fs := core.FloodSettings{MaxMessages: 3, WindowSec: 10}
+	now := time.Now()
+	for i, text := range []string{"one", "two"} {
+		if reason, flooded := fd.check(1, 2, &tb.Message{Text: text}, fs, now.Add(time.Duration(i)*time.Second)); flooded {
+			t.Fatalf("message %d flagged as %s", i+1, reason)
+		}
+	}
+	reason, flooded := fd.check(1, 2, &tb.Message{Text: "three"}, fs, now.Add(2*time.Second))
+	if !flooded || reason != floodReasonRate {
+		t.Fatalf("third message in the window: got %q, %v", reason, flooded)
+	}
+}
+
+func TestFloodWindowExpiry(t *testing.T) {
+	fd := newFloodDetector()
+	fs := core.FloodSettings{MaxMessages: 3, WindowSec: 10}
+	now := time.Now()
+	fd.check(1, 2, &tb.Message{Text: "one"}, fs, now)
+	fd.check(1, 2, &tb.Message{Text: "two"}, fs, now.Add(time.Second))
+	if reason, flooded := fd.check(1, 2, &tb.Message{Text: "three"}, fs, now.Add(11*time.Second)); flooded {
+		t.Fatalf("messages outside the window counted: %s", reason)
+	}
+}
+
+func TestFloodIdentical(t *testing.T) {
+	fd := newFloodDetector()
+	fs := core.FloodSettings{MaxIdentical: 3, WindowSec: 10}
+	now := time.Now()
+	fd.check(1, 2, &tb.Message{Text: "buy now"}, fs, now)
+	fd.check(1, 2, &tb.Message{Text: "Buy  NOW"}, fs, now)
+	if _, flooded := fd.check(1, 3, &tb.Message{Text: "buy now"}, fs, now); flooded {
+		t.Fatal("messages of another user counted")
+	}
+	reason, flooded := fd.check(1, 2, &tb.Message{Text: " buy now "}, fs, now)
+	if !flooded || reason != floodReasonIdentical {
+		t.Fatalf("third identical message: got %q, %v", reason, flooded)
+	}
+}
+
+func TestFloodLines(t *testing.T) {
+	fd := newFloodDetector()
+	fs := core.FloodSettings{MaxLines: 5, WindowSec: 10}
+	text := strings.Repeat("a\n", 5)
+	reason, flooded := fd.check(1, 2, &tb.Message{Text: text}, fs, time.Now())
+	if !flooded || reason != floodReasonLines {
+		t.Fatalf("short lines: got %q, %v", reason, flooded)
+	}
+	if _, flooded := fd.check(1, 2, &tb.Message{Text: "a normal sentence\nand another long one"}, fs, time.Now()); flooded {
+		t.Fatal("long lines flagged")
+	}
+}
+
+func TestFloodPrune(t *testing.T) {
+	fd := newFloodDetector()
+	fs := core.FloodSettings{MaxMessages: 100, WindowSec: 10}
+	now := time.Now()
+	fd.check(1, 2, &tb.Message{Text: "old"}, fs, now)
+	fd.check(5, 6, &tb.Message{Text: "old"}, fs, now)
+	fd.check(1, 3, &tb.Message{Text: "new"}, fs, now.Add(floodPruneInterval))
+
+	if _, ok := fd.chats[1][2]; ok {
+		t.Error("idle user kept")
+	}
+	if _, ok := fd.chats[5]; ok {
+		t.Error("idle chat kept")
+	}
+	if len(fd.chats[1][3]) != 1 {
+		t.Error("active user dropped")
+	}
+}
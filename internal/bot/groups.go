@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// RegisterGroup remembers group chat for global actions
+func (ah *AdminHandler) RegisterGroup(chat *tb.Chat) {
+	if chat == nil || chat.ID == ah.adminChatID || (chat.Type != tb.ChatGroup && chat.Type != tb.ChatSuperGroup) {
+		return
+	}
+	ah.groupMu.Lock()
+	title, known := ah.groups[chat.ID]
+	if known && title == chat.Title {
+		ah.groupMu.Unlock()
+		return
+	}
+	ah.groups[chat.ID] = chat.Title
+	ah.groupMu.Unlock()
+	ah.saveGroups()
+	if !known {
+		logrus.WithFields(logrus.Fields{"chat_id": chat.ID, "title": chat.Title}).Info("Group registered")
+	}
+}
+
+// UnregisterGroup forgets a group chat
+func (ah *AdminHandler) UnregisterGroup(chatID int64) {
+	ah.groupMu.Lock()
+	_, known := ah.groups[chatID]
+	delete(ah.groups, chatID)
+	ah.groupMu.Unlock()
+	if known {
+		ah.saveGroups()
+		logrus.WithField("chat_id", chatID).Info("Group unregistered")
+	}
+}
+
+// AllGroupIDs returns all stored group IDs
+func (ah *AdminHandler) AllGroupIDs() []int64 {
+	ah.groupMu.RLock()
+	defer ah.groupMu.RUnlock()
+	ids := make([]int64, 0, len(ah.groups))
+	for id := range ah.groups {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// IsAdminAnywhere reports whether a user is an admin of the admin chat or of any registered group
+func (ah *AdminHandler) IsAdminAnywhere(user *tb.User) bool {
+	if ah.IsAdmin(&tb.Chat{ID: ah.adminChatID}, user) {
+		return true
+	}
+	for _, chatID := range ah.AllGroupIDs() {
+		if ah.IsAdmin(&tb.Chat{ID: chatID}, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateGroup moves registry entry and chat-bound records to the new chat ID
+func (ah *AdminHandler) MigrateGroup(from, to int64) {
+	ah.groupMu.Lock()
+	title, known := ah.groups[from]
+	delete(ah.groups, from)
+	if known {
+		ah.groups[to] = title
+	}
+	ah.groupMu.Unlock()
+	ah.saveGroups()
+	if from == ah.adminChatID {
+		logrus.WithFields(logrus.Fields{"from": from, "to": to}).Warn("Admin chat migrated, ADMIN_CHAT_ID must be updated")
+	}
+
+	ah.violationsMu.Lock()
+	for uid, list := range ah.records {
+		for i := range list {
+			if list[i].ChatID == from {
+				list[i].ChatID = to
+			}
+		}
+		ah.records[uid] = list
+	}
+	ah.violationsMu.Unlock()
+	ah.saveRecords()
+
+	ah.bansMu.Lock()
+	for uid, rec := range ah.bans {
+		if rec.ChatID == from {
+			rec.ChatID = to
+			ah.bans[uid] = rec
+		}
+	}
+	ah.bansMu.Unlock()
+	ah.saveBans()
+
+	ah.history.Migrate(from, to)
+	logrus.WithFields(logrus.Fields{"from": from, "to": to}).Info("Group migrated")
+}
+
+// TrackGroups registers every group the bot receives updates from
+func (ah *AdminHandler) TrackGroups(next tb.HandlerFunc) tb.HandlerFunc {
+	return func(c tb.Context) error {
+		if c.Chat() != nil {
+			ah.RegisterGroup(c.Chat())
+		}
+		return next(c)
+	}
+}
+
+// HandleMyChatMember follows the bot being added to or removed from groups
+func (ah *AdminHandler) HandleMyChatMember(c tb.Context) error {
+	upd := c.ChatMember()
+	if upd == nil || upd.Chat == nil || upd.NewChatMember == nil {
+		return nil
+	}
+	switch upd.NewChatMember.Role {
+	case tb.Left, tb.Kicked:
+		ah.UnregisterGroup(upd.Chat.ID)
+		ah.LogToAdmin(fmt.Sprintf("🚪 Бот удалён из группы.\n\nГруппа: %s (ID: %d)", upd.Chat.Title, upd.Chat.ID))
+	default:
+		ah.RegisterGroup(upd.Chat)
+		if upd.OldChatMember == nil || upd.OldChatMember.Role == tb.Left || upd.OldChatMember.Role == tb.Kicked {
+			ah.LogToAdmin(fmt.Sprintf("➕ Бот добавлен в группу.\n\nГруппа: %s (ID: %d)", upd.Chat.Title, upd.Chat.ID))
+		}
+	}
+	return nil
+}
+
+// HandleMigration follows group to supergroup migrations
+func (ah *AdminHandler) HandleMigration(c tb.Context) error {
+	from, to := c.Migration()
+	if from == 0 || to == 0 {
+		return nil
+	}
+	ah.MigrateGroup(from, to)
+	ah.LogToAdmin(fmt.Sprintf("🔄 Группа преобразована в супергруппу.\n\nСтарый ID: %d\nНовый ID: %d", from, to))
+	return nil
+}
+
+// saveGroups persists the group registry to disk
+func (ah *AdminHandler) saveGroups() {
+	ah.groupMu.RLock()
+	data, err := json.MarshalIndent(ah.groups, "", "  ")
+	ah.groupMu.RUnlock()
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(ah.groupsFile, data, 0644)
+}
+
+// loadGroups reads the group registry from disk
+func (ah *AdminHandler) loadGroups() {
+	data, err := os.ReadFile(ah.groupsFile)
+	if err != nil {
+		return
+	}
+	ah.groupMu.Lock()
+	_ = json.Unmarshal(data, &ah.groups)
+	if ah.groups == nil {
+		ah.groups = make(map[int64]string)
+	}
+	ah.groupMu.Unlock()
+}
@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// Hidden-character actions
+const (
+	HiddenOff    = "off"
+	HiddenFlag   = "flag"
+	HiddenDelete = "delete"
+	HiddenMute   = "mute"
+)
+
+// hiddenDetector finds bidi overrides, invisible characters, zalgo text and mixed-script words
+type hiddenDetector struct {
+	mu       sync.Mutex
+	flagged  map[int64]string
+	action   string
+	mute     time.Duration
+	maxInvis int
+	maxMarks float64
+	maxMixed int
+}
+
+// newHiddenDetector creates the detector configured from the environment
+func newHiddenDetector() *hiddenDetector {
+	action := strings.ToLower(envString("HIDDEN_ACTION", HiddenDelete))
+	switch action {
+	case HiddenOff, HiddenFlag, HiddenDelete, HiddenMute:
+	default:
+		logrus.WithField("action", action).Warn("Unknown HIDDEN_ACTION, using delete")
+		action = HiddenDelete
+	}
+	return &hiddenDetector{
+		flagged:  make(map[int64]string),
+		action:   action,
+		mute:     envDuration("HIDDEN_MUTE", time.Hour),
+		maxInvis: envInt("HIDDEN_MAX_INVISIBLE", 3),
+		maxMarks: envFloat("HIDDEN_MAX_COMBINING", 0.3),
+		maxMixed: envInt("HIDDEN_MAX_MIXED_WORDS", 2),
+	}
+}
+
+// isBidiControl reports embedding, override and isolate controls
+func isBidiControl(r rune) bool {
+	return (r >= 0x202A && r <= 0x202E) || (r >= 0x2066 && r <= 0x2069)
+}
+
+// isInvisible reports zero-width and blank filler characters, ZWJ is handled separately because emoji sequences use it
+func isInvisible(r rune) bool {
+	switch r {
+	case 0x00AD, 0x034F, 0x115F, 0x1160, 0x180E, 0x200B, 0x200C, 0x200E, 0x200F, 0x2060, 0x2061, 0x2062, 0x2063, 0x2064, 0x3164, 0xFEFF, 0xFFA0, 0x2800:
+		return true
+	}
+	return false
+}
+
+// scriptOf returns the script of a letter that matters for homoglyph spoofing
+func scriptOf(r rune) string {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return "latin"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "cyrillic"
+	case unicode.Is(unicode.Greek, r):
+		return "greek"
+	}
+	return ""
+}
+
+// mixedScriptWords counts words that combine letters of different scripts
+func mixedScriptWords(text string) int {
+	n := 0
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r) }) {
+		first := ""
+		for _, r := range w {
+			s := scriptOf(r)
+			if s == "" {
+				continue
+			}
+			if first == "" {
+				first = s
+			} else if s != first {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// signals returns the reasons a text looks disguised
+func (hd *hiddenDetector) signals(text string) []string {
+	var out []string
+	bidi, invisible, marks, letters := 0, 0, 0, 0
+	prev := rune(0)
+	for _, r := range text {
+		switch {
+		case isBidiControl(r):
+			bidi++
+		case isInvisible(r):
+			invisible++
+		case r == 0x200D && unicode.IsLetter(prev):
+			// A joiner inside a word, emoji sequences join symbols
+			invisible++
+		case unicode.Is(unicode.Mn, r):
+			marks++
+		case unicode.IsLetter(r):
+			letters++
+		}
+		prev = r
+	}
+	if bidi > 0 {
+		out = append(out, fmt.Sprintf("управление направлением текста: %d", bidi))
+	}
+	if hd.maxInvis > 0 && invisible >= hd.maxInvis {
+		out = append(out, fmt.Sprintf("невидимые символы: %d", invisible))
+	}
+	// A handful of marks is normal for decomposed text, zalgo stacks many per letter
+	if hd.maxMarks > 0 && marks >= 5 && float64(marks) > hd.maxMarks*float64(letters+marks) {
+		out = append(out, fmt.Sprintf("комбинируемые символы: %d на %d букв", marks, letters))
+	}
+	if hd.maxMixed > 0 {
+		if n := mixedScriptWords(text); n >= hd.maxMixed {
+			out = append(out, fmt.Sprintf("слова из смешанных алфавитов: %d", n))
+		}
+	}
+	return out
+}
+
+// newName reports whether a suspicious display name of the user wasn't flagged yet
+func (hd *hiddenDetector) newName(userID int64, name string) bool {
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	if hd.flagged[userID] == name {
+		return false
+	}
+	if len(hd.flagged) > 10000 {
+		hd.flagged = make(map[int64]string)
+	}
+	hd.flagged[userID] = name
+	return true
+}
+
+// revealHidden makes control and invisible characters visible so a log can't be disrupted by them
+func revealHidden(text string) string {
+	var b strings.Builder
+	marks := 0
+	for _, r := range text {
+		if isBidiControl(r) || isInvisible(r) || r == 0x200D {
+			fmt.Fprintf(&b, "<U+%04X>", r)
+			continue
+		}
+		if unicode.Is(unicode.Mn, r) {
+			marks++
+			if marks > 2 {
+				continue
+			}
+		} else {
+			marks = 0
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// checkHidden applies the hidden-character policy, returns true if the message was removed
+func (fh *FeatureHandler) checkHidden(c tb.Context) bool {
+	if fh.hidden == nil || fh.hidden.action == HiddenOff || fh.adminHandler == nil {
+		return false
+	}
+	msg := c.Message()
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	name := strings.TrimSpace(msg.Sender.FirstName + " " + msg.Sender.LastName)
+	textSignals := fh.hidden.signals(text)
+	nameSignals := fh.hidden.signals(name)
+	if len(textSignals) == 0 && len(nameSignals) == 0 {
+		return false
+	}
+
+	userName := revealHidden(fh.adminHandler.GetUserDisplayName(msg.Sender))
+	if len(textSignals) == 0 {
+		// Names can't be removed, admins are told once per name
+		if !fh.hidden.newName(msg.Sender.ID, name) {
+			return false
+		}
+		logMsg := fmt.Sprintf("🕵️ Подозрительные символы в имени пользователя.\n\nПользователь: %s\nИмя: %s\nЧат: %s\nПризнаки: %s", userName, revealHidden(name), c.Chat().Title, strings.Join(nameSignals, "; "))
+		fh.logWithActions(logMsg, msg.Sender, c.Chat().ID, "", LogActionBan, LogActionForgive)
+		logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID}).Info("Display name flagged for hidden characters")
+		return false
+	}
+
+	signals := append(textSignals, nameSignals...)
+	rule := "hidden: " + strings.Join(signals, "; ")
+	excerpt := revealHidden(text)
+	if fh.hidden.action == HiddenFlag {
+		logMsg := fmt.Sprintf("🕵️ Сообщение со скрытыми или маскирующими символами.\n\nПользователь: %s\nЧат: %s\nПризнаки: %s\nСообщение: `%s`", userName, c.Chat().Title, strings.Join(signals, "; "), excerpt)
+		fh.logWithActions(logMsg, msg.Sender, c.Chat().ID, text, LogActionBan, LogActionForgive)
+		logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID}).Info("Message flagged for hidden characters")
+		return false
+	}
+
+	if err := fh.bot.Delete(msg); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": c.Chat().ID, "message_id": msg.ID}).Warn("Failed to delete message with hidden characters")
+	}
+	fh.adminHandler.AddViolation(msg.Sender.ID, c.Chat().ID, rule, excerpt)
+	fh.adminHandler.Audit(core.AuditViolation, nil, msg.Sender, c.Chat().ID, rule, excerpt)
+
+	lang := fh.getLangForUser(msg.Sender)
+	msgs := i18n.Get().T(lang)
+	action := "удалено"
+	notice := fmt.Sprintf(msgs.Hidden.Deleted, userName)
+	if fh.hidden.action == HiddenMute {
+		until := fh.adminHandler.MuteUser(c.Chat(), msg.Sender, fh.hidden.mute).Format("2006-01-02 15:04")
+		action = "удалено, мут до " + until
+		notice = fmt.Sprintf(msgs.Hidden.Muted, userName, until)
+	}
+	sent, _ := fh.bot.Send(c.Chat(), notice)
+	fh.adminHandler.DeleteAfter(sent, 15*time.Second)
+
+	logMsg := fmt.Sprintf("🕵️ Сообщение со скрытыми или маскирующими символами %s.\n\nПользователь: %s\nЧат: %s\nПризнаки: %s\nНарушений: %d\nСообщение: `%s`", action, userName, c.Chat().Title, strings.Join(signals, "; "), fh.adminHandler.GetViolations(msg.Sender.ID), excerpt)
+	actions := []string{LogActionBan, LogActionForgive}
+	if fh.hidden.action == HiddenMute {
+		actions = []string{LogActionUnrestrict, LogActionBan}
+	}
+	fh.logWithActions(logMsg, msg.Sender, c.Chat().ID, text, actions...)
+	logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID, "action": fh.hidden.action}).Info("Message with hidden characters removed")
+	return true
+}
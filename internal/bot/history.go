@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// historySize is the number of recent messages kept per chat
+const historySize = 1000
+
+// historyEntry references a single message of a chat
+type historyEntry struct {
+	MsgID  int
+	UserID int64
+	Time   time.Time
+}
+
+// chatHistory is a fixed-size ring buffer of recent messages
+type chatHistory struct {
+	entries []historyEntry
+	next    int
+}
+
+// MessageHistory keeps recent message IDs by sender for every chat
+type MessageHistory struct {
+	mu    sync.Mutex
+	chats map[int64]*chatHistory
+}
+
+// NewMessageHistory creates an empty message history
+func NewMessageHistory() *MessageHistory {
+	return &MessageHistory{chats: make(map[int64]*chatHistory)}
+}
+
+// Add remembers a message
+func (h *MessageHistory) Add(chatID int64, msgID int, userID int64, t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch, ok := h.chats[chatID]
+	if !ok {
+		ch = &chatHistory{entries: make([]historyEntry, 0, historySize)}
+		h.chats[chatID] = ch
+	}
+	e := historyEntry{MsgID: msgID, UserID: userID, Time: t}
+	if len(ch.entries) < historySize {
+		ch.entries = append(ch.entries, e)
+		return
+	}
+	ch.entries[ch.next] = e
+	ch.next = (ch.next + 1) % historySize
+}
+
+// TakeUserMessages removes and returns IDs of user's messages in chat since the given time
+func (h *MessageHistory) TakeUserMessages(chatID, userID int64, since time.Time) []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch, ok := h.chats[chatID]
+	if !ok {
+		return nil
+	}
+	var ids []int
+	for i := range ch.entries {
+		e := &ch.entries[i]
+		if e.MsgID != 0 && e.UserID == userID && !e.Time.Before(since) {
+			ids = append(ids, e.MsgID)
+			e.MsgID = 0
+		}
+	}
+	return ids
+}
+
+// Chats returns IDs of chats with recorded messages
+func (h *MessageHistory) Chats() []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids := make([]int64, 0, len(h.chats))
+	for id := range h.chats {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Migrate moves the history of a chat to its new ID
+func (h *MessageHistory) Migrate(from, to int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ch, ok := h.chats[from]; ok {
+		h.chats[to] = ch
+		delete(h.chats, from)
+	}
+}
+
+// TrackMessages remembers every group message for later purges
+func (ah *AdminHandler) TrackMessages(next tb.HandlerFunc) tb.HandlerFunc {
+	return func(c tb.Context) error {
+		msg := c.Message()
+		if msg != nil && msg.Sender != nil && c.Chat() != nil && c.Chat().Type != tb.ChatPrivate && c.Chat().ID != ah.adminChatID {
+			ah.history.Add(c.Chat().ID, msg.ID, msg.Sender.ID, msg.Time())
+		}
+		return next(c)
+	}
+}
+
+// PurgeUserMessages deletes user's recent messages in every known group and returns how many were removed
+func (ah *AdminHandler) PurgeUserMessages(userID int64) int {
+	since := time.Now().Add(-ah.purgeWindow)
+	removed := 0
+	for _, chatID := range ah.history.Chats() {
+		for _, msgID := range ah.history.TakeUserMessages(chatID, userID, since) {
+			stored := tb.StoredMessage{MessageID: strconv.Itoa(msgID), ChatID: chatID}
+			if err := ah.bot.Delete(stored); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"chat_id": chatID, "message_id": msgID}).Debug("Failed to purge message")
+				continue
+			}
+			removed++
+		}
+	}
+	if removed > 0 {
+		logrus.WithFields(logrus.Fields{"user_id": userID, "removed": removed}).Info("Purged user messages")
+	}
+	return removed
+}
@@ -31,8 +31,17 @@ type FeatureHandlerInterface interface {
 	HandlePrivateMessage(c tb.Context) error
 	RateLimit(handler func(tb.Context) error) func(tb.Context) error
 	RegisterQuizHandlers(bot *tb.Bot)
-	CreateQuizHandler(i int, q QuestionInterface, btn tb.InlineButton) func(tb.Context) error
+	HandleQuizAnswer(c tb.Context) error
 	FilterMessage(c tb.Context) error
+	HandleLogAction(c tb.Context) error
+	HandleFlood(c tb.Context) error
+	HandleLock(c tb.Context) error
+	HandleUnlock(c tb.Context) error
+	HandleLocks(c tb.Context) error
+	HandleDuplicateBanAll(c tb.Context) error
+	HandlePremod(c tb.Context) error
+	HandleLockdownEnd(c tb.Context) error
+	MigrateChat(from, to int64)
 }
 
 var _ = time.Now
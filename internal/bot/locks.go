@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// Content types that can be locked in a chat
+const (
+	LockForward = "forward"
+	LockLink    = "link"
+	LockSticker = "sticker"
+	LockGIF     = "gif"
+	LockVoice   = "voice"
+	LockPoll    = "poll"
+	LockContact = "contact"
+	LockMedia   = "media"
+)
+
+// lockTypes lists all lockable content types in display order
+var lockTypes = []string{LockForward, LockLink, LockSticker, LockGIF, LockVoice, LockPoll, LockContact, LockMedia}
+
+// contentTypes classifies a message into lockable content types
+func contentTypes(msg *tb.Message) []string {
+	var types []string
+	if msg.Origin != nil || msg.IsForwarded() {
+		types = append(types, LockForward)
+	}
+	if hasLink(msg.Entities) || hasLink(msg.CaptionEntities) {
+		types = append(types, LockLink)
+	}
+	switch {
+	case msg.Sticker != nil:
+		types = append(types, LockSticker)
+	case msg.Animation != nil:
+		types = append(types, LockGIF)
+	case msg.Voice != nil:
+		types = append(types, LockVoice)
+	case msg.Poll != nil:
+		types = append(types, LockPoll)
+	case msg.Contact != nil:
+		types = append(types, LockContact)
+	case msg.Photo != nil, msg.Video != nil, msg.VideoNote != nil, msg.Document != nil, msg.Audio != nil:
+		types = append(types, LockMedia)
+	}
+	return types
+}
+
+// hasLink reports whether entities contain a URL
+func hasLink(entities tb.Entities) bool {
+	for _, e := range entities {
+		if e.Type == tb.EntityURL || e.Type == tb.EntityTextLink {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLocks deletes locked content, returns true if the message was deleted
+func (fh *FeatureHandler) checkLocks(c tb.Context) bool {
+	if fh.settings == nil {
+		return false
+	}
+	locks := fh.settings.Get(c.Chat().ID).Locks
+	if len(locks) == 0 {
+		return false
+	}
+	msg := c.Message()
+	locked := ""
+	for _, t := range contentTypes(msg) {
+		if slices.Contains(locks, t) {
+			locked = t
+			break
+		}
+	}
+	if locked == "" {
+		return false
+	}
+
+	if err := fh.bot.Delete(msg); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": c.Chat().ID, "message_id": msg.ID}).Warn("Failed to delete locked content")
+		return false
+	}
+	if fh.lockViolation && fh.adminHandler != nil {
+		excerpt := msg.Text
+		if excerpt == "" {
+			excerpt = msg.Caption
+		}
+		fh.adminHandler.AddViolation(msg.Sender.ID, c.Chat().ID, "lock: "+locked, excerpt)
+		fh.adminHandler.Audit(core.AuditViolation, nil, msg.Sender, c.Chat().ID, "lock: "+locked, excerpt)
+	}
+
+	lang := fh.getLangForUser(msg.Sender)
+	msgs := i18n.Get().T(lang)
+	notice, _ := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Locks.Deleted, fh.adminHandler.GetUserDisplayName(msg.Sender), locked))
+	fh.adminHandler.DeleteAfter(notice, 10*time.Second)
+	logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID, "type": locked}).Info("Deleted locked content")
+	return true
+}
+
+// lockArgs validates content type arguments
+func lockArgs(args []string) ([]string, bool) {
+	var types []string
+	for _, a := range args {
+		a = strings.ToLower(strings.Trim(a, ","))
+		if !slices.Contains(lockTypes, a) {
+			return nil, false
+		}
+		if !slices.Contains(types, a) {
+			types = append(types, a)
+		}
+	}
+	return types, len(types) > 0
+}
+
+// lockCommandAllowed checks that the lock commands are used by an admin in a group
+func (fh *FeatureHandler) lockCommandAllowed(c tb.Context, msgs *i18n.Messages) bool {
+	if c.Message() == nil || c.Sender() == nil || c.Chat().Type == tb.ChatPrivate || c.Chat().ID == fh.adminChatID || !fh.adminHandler.IsAdmin(c.Chat(), c.Sender()) {
+		msg, _ := fh.bot.Send(c.Chat(), msgs.Locks.CommandAdminOnly)
+		fh.adminHandler.DeleteAfter(msg, 10*time.Second)
+		return false
+	}
+	return true
+}
+
+// HandleLock forbids content types in a chat: /lock sticker gif
+func (fh *FeatureHandler) HandleLock(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if !fh.lockCommandAllowed(c, msgs) {
+		return nil
+	}
+	types, ok := lockArgs(c.Args())
+	if !ok {
+		msg, _ := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Locks.Usage, strings.Join(lockTypes, ", ")))
+		fh.adminHandler.DeleteAfter(msg, 15*time.Second)
+		return nil
+	}
+	fh.settings.Update(c.Chat().ID, func(cs *core.ChatSettings) {
+		for _, t := range types {
+			if !slices.Contains(cs.Locks, t) {
+				cs.Locks = append(cs.Locks, t)
+			}
+		}
+	})
+	fh.adminHandler.Audit(core.AuditLock, c.Sender(), nil, c.Chat().ID, "lock", strings.Join(types, " "))
+	fh.adminHandler.LogToAdmin(fmt.Sprintf("🔒 Ограничены типы сообщений.\n\nЧат: %s\nТипы: %s\nАдмин: %s", c.Chat().Title, strings.Join(types, ", "), fh.adminHandler.GetUserDisplayName(c.Sender())))
+	_, err := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Locks.Locked, strings.Join(types, ", ")))
+	return err
+}
+
+// HandleUnlock allows content types again, without arguments it lifts all locks: /unlock [sticker gif]
+func (fh *FeatureHandler) HandleUnlock(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if !fh.lockCommandAllowed(c, msgs) {
+		return nil
+	}
+	args := c.Args()
+	types := lockTypes
+	if len(args) > 0 && !(len(args) == 1 && strings.EqualFold(args[0], "all")) {
+		var ok bool
+		if types, ok = lockArgs(args); !ok {
+			msg, _ := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Locks.Usage, strings.Join(lockTypes, ", ")))
+			fh.adminHandler.DeleteAfter(msg, 15*time.Second)
+			return nil
+		}
+	}
+	fh.settings.Update(c.Chat().ID, func(cs *core.ChatSettings) {
+		cs.Locks = slices.DeleteFunc(cs.Locks, func(t string) bool { return slices.Contains(types, t) })
+	})
+	fh.adminHandler.Audit(core.AuditUnlock, c.Sender(), nil, c.Chat().ID, "unlock", strings.Join(types, " "))
+	fh.adminHandler.LogToAdmin(fmt.Sprintf("🔓 Сняты ограничения на типы сообщений.\n\nЧат: %s\nТипы: %s\nАдмин: %s", c.Chat().Title, strings.Join(types, ", "), fh.adminHandler.GetUserDisplayName(c.Sender())))
+	_, err := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Locks.Unlocked, strings.Join(types, ", ")))
+	return err
+}
+
+// HandleLocks lists locked content types of a chat
+func (fh *FeatureHandler) HandleLocks(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if !fh.lockCommandAllowed(c, msgs) {
+		return nil
+	}
+	locks := fh.settings.Get(c.Chat().ID).Locks
+	if len(locks) == 0 {
+		_, err := fh.bot.Send(c.Chat(), msgs.Locks.None)
+		return err
+	}
+	_, err := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Locks.List, strings.Join(locks, ", ")))
+	return err
+}
@@ -0,0 +1,285 @@
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// Actions available on admin-chat log entries
+const (
+	LogActionBan        = "ban"
+	LogActionForgive    = "forgive"
+	LogActionUnrestrict = "unrestrict"
+	LogActionRequiz     = "requiz"
+	LogActionBlacklist  = "blacklist"
+)
+
+const maxLogExcerpts = 500
+
+// logExcerpts keeps message excerpts referenced by log buttons, since callback data is limited to 64 bytes
+//
+// Tokens are random, so a button left from before a restart can't point at another message.
+type logExcerpts struct {
+	mu    sync.Mutex
+	order []string
+	items map[string]string
+}
+
+// newLogToken returns a random token short enough for callback data
+func newLogToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// put stores an excerpt and returns its token
+func (le *logExcerpts) put(excerpt string) string {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if le.items == nil {
+		le.items = make(map[string]string)
+	}
+	token := newLogToken()
+	le.items[token] = excerpt
+	le.order = append(le.order, token)
+	if len(le.order) > maxLogExcerpts {
+		delete(le.items, le.order[0])
+		le.order = le.order[1:]
+	}
+	return token
+}
+
+// get returns the excerpt for a token
+func (le *logExcerpts) get(token string) (string, bool) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	v, ok := le.items[token]
+	return v, ok
+}
+
+// LogActionButton returns the button routed to HandleLogAction
+func LogActionButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("logact", msgs.LogActions.Ban)
+}
+
+// logActionLabel returns the button text of an action
+func logActionLabel(msgs *i18n.Messages, action string) string {
+	switch action {
+	case LogActionBan:
+		return msgs.LogActions.Ban
+	case LogActionForgive:
+		return msgs.LogActions.Forgive
+	case LogActionUnrestrict:
+		return msgs.LogActions.Unrestrict
+	case LogActionRequiz:
+		return msgs.LogActions.Requiz
+	case LogActionBlacklist:
+		return msgs.LogActions.Blacklist
+	}
+	return action
+}
+
+// logWithActions sends a log entry with action buttons about a user in a chat
+func (fh *FeatureHandler) logWithActions(message string, user *tb.User, chatID int64, excerpt string, actions ...string) {
+	if fh.adminHandler == nil {
+		return
+	}
+	msgs := i18n.Get().T(i18n.Get().GetDefault())
+
+	token := ""
+	if excerpt != "" {
+		token = fh.logExcerpts.put(excerpt)
+	}
+	var row []tb.InlineButton
+	var rows [][]tb.InlineButton
+	for _, action := range actions {
+		if action == LogActionBlacklist && token == "" {
+			continue
+		}
+		btn := LogActionButton()
+		btn.Text = logActionLabel(msgs, action)
+		btn.Data = strings.Join([]string{action, strconv.FormatInt(user.ID, 10), strconv.FormatInt(chatID, 10), token}, "|")
+		row = append(row, btn)
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	fh.adminHandler.LogToAdminWithMarkup(message, &tb.ReplyMarkup{InlineKeyboard: rows})
+}
+
+// HandleLogAction routes clicks on admin-chat log buttons
+func (fh *FeatureHandler) HandleLogAction(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	cb := c.Callback()
+	if cb == nil || c.Sender() == nil || c.Message() == nil {
+		return nil
+	}
+	if !fh.adminHandler.IsAdmin(&tb.Chat{ID: fh.adminChatID}, c.Sender()) {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Buttons.NotYourButton})
+		return nil
+	}
+	args := strings.Split(cb.Data, "|")
+	if len(args) != 4 {
+		_ = fh.bot.Respond(cb)
+		return nil
+	}
+	action := args[0]
+	userID, err1 := strconv.ParseInt(args[1], 10, 64)
+	chatID, err2 := strconv.ParseInt(args[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		_ = fh.bot.Respond(cb)
+		return nil
+	}
+	user := &tb.User{ID: userID}
+	chat := &tb.Chat{ID: chatID}
+	if member, err := fh.bot.ChatMemberOf(chat, user); err == nil && member.User != nil {
+		user = member.User
+	}
+
+	excerpt, hasExcerpt := fh.logExcerpts.get(args[3])
+	details := ""
+	switch action {
+	case LogActionBan:
+		if fh.adminHandler.IsAdmin(chat, user) {
+			_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Admin.SpambanCannotBanAdmin})
+			return nil
+		}
+		fh.adminHandler.BanUserEverywhere(user, "admin log", excerpt, c.Sender())
+		fh.adminHandler.ClearViolations(userID)
+		fh.trainClassifier(excerpt, true)
+	case LogActionForgive:
+		fh.adminHandler.ClearViolations(userID)
+		fh.trainClassifier(excerpt, false)
+	case LogActionUnrestrict:
+		fh.SetUserRestriction(chat, user, true)
+		fh.state.ClearNewbie(int(userID))
+		fh.state.Reset(int(userID))
+		fh.verificationDone(chat, user)
+	case LogActionRequiz:
+		// An admin grants a fresh set of attempts
+		fh.state.ClearQuizFails(chat.ID, int(user.ID))
+		fh.SetUserRestriction(chat, user, false)
+		fh.sendWelcome(chat, user)
+	case LogActionBlacklist:
+		phrases := blacklistTerms(excerpt, fh.blacklist.List())
+		if !hasExcerpt || len(phrases) == 0 {
+			_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.LogActions.Expired})
+			return nil
+		}
+		var added []string
+		for _, phrase := range phrases {
+			fh.blacklist.AddPhrase(phrase)
+			added = append(added, strings.Join(phrase, " "))
+		}
+		details = strings.Join(added, "; ")
+		fh.trainClassifier(excerpt, true)
+	default:
+		_ = fh.bot.Respond(cb)
+		return nil
+	}
+
+	auditActions := map[string]string{
+		LogActionBan:        core.AuditSpamBan,
+		LogActionForgive:    core.AuditForgive,
+		LogActionUnrestrict: core.AuditUnrestrict,
+		LogActionRequiz:     core.AuditRequiz,
+		LogActionBlacklist:  core.AuditBanWord,
+	}
+	fh.adminHandler.Audit(auditActions[action], c.Sender(), user, chatID, "admin log", details)
+
+	adminMsgs := i18n.Get().T(i18n.Get().GetDefault())
+	note := fmt.Sprintf(adminMsgs.LogActions.DoneBy, logActionLabel(adminMsgs, action), fh.adminHandler.GetUserDisplayName(c.Sender()))
+	_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: note})
+	if _, err := fh.bot.Edit(c.Message(), c.Message().Text+"\n\n"+note, withoutButton(c.Message().ReplyMarkup, cb.Data)); err != nil {
+		logrus.WithError(err).Warn("Failed to edit admin log entry")
+	}
+	logrus.WithFields(logrus.Fields{"action": action, "user_id": userID, "chat_id": chatID, "admin_id": c.Sender().ID}).Info("Admin log action applied")
+	return nil
+}
+
+// maxBlacklistWords limits the words taken from a message without links or mentions
+const maxBlacklistWords = 3
+
+// blacklistTerms picks the distinctive parts of a spam message that aren't blacklisted yet
+//
+// Links and mentions become phrases of their own. Without them the longest words form one phrase,
+// which matches only when all of them appear, so rewordings of the same spam are still caught.
+func blacklistTerms(text string, existing [][]string) [][]string {
+	known := func(phrase []string) bool {
+		return slices.ContainsFunc(existing, func(p []string) bool { return slices.Equal(p, phrase) })
+	}
+	var phrases [][]string
+	var words []string
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		w := strings.TrimFunc(field, func(r rune) bool { return unicode.IsPunct(r) && r != '@' && r != '/' })
+		switch {
+		case strings.HasPrefix(w, "@") || strings.HasPrefix(w, "http") || strings.Contains(w, "t.me/"):
+			if phrase := []string{w}; !known(phrase) && !slices.ContainsFunc(phrases, func(p []string) bool { return slices.Equal(p, phrase) }) {
+				phrases = append(phrases, phrase)
+			}
+		case utf8.RuneCountInString(w) >= 5 && !slices.Contains(words, w):
+			words = append(words, w)
+		}
+	}
+	if len(phrases) > 0 || len(words) == 0 {
+		return phrases
+	}
+	slices.SortStableFunc(words, func(a, b string) int { return utf8.RuneCountInString(b) - utf8.RuneCountInString(a) })
+	phrase := words[:min(len(words), maxBlacklistWords)]
+	if known(phrase) {
+		return nil
+	}
+	return [][]string{phrase}
+}
+
+// trainClassifier feeds an admin decision about a message to the classifier
+func (fh *FeatureHandler) trainClassifier(text string, spam bool) {
+	if fh.classifier == nil || text == "" {
+		return
+	}
+	fh.classifier.Train(text, spam)
+}
+
+// withoutButton returns a copy of the keyboard without the button carrying data, or nil if nothing is left
+func withoutButton(rm *tb.ReplyMarkup, data string) *tb.ReplyMarkup {
+	if rm == nil {
+		return nil
+	}
+	out := &tb.ReplyMarkup{}
+	for _, row := range rm.InlineKeyboard {
+		var kept []tb.InlineButton
+		for _, btn := range row {
+			if !strings.HasSuffix(btn.Data, data) {
+				kept = append(kept, btn)
+			}
+		}
+		if len(kept) > 0 {
+			out.InlineKeyboard = append(out.InlineKeyboard, kept)
+		}
+	}
+	if len(out.InlineKeyboard) == 0 {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"UEPB/internal/core"
+)
+
+// SMTPMailer sends plain text mail through an SMTP relay
+//
+// Authentication is used only when a user is set, so a local relay without TLS works as well.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates a mailer for a relay given as host:port
+func NewSMTPMailer(addr, user, password, from string) *SMTPMailer {
+	m := &SMTPMailer{addr: addr, from: from}
+	if user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return m
+}
+
+// MailerFromEnv returns the mailer configured by SMTP_ADDR, or nil if it is not set
+func MailerFromEnv() core.Mailer {
+	addr := envString("SMTP_ADDR", "")
+	if addr == "" {
+		return nil
+	}
+	return NewSMTPMailer(addr, envString("SMTP_USER", ""), envString("SMTP_PASSWORD", ""), envString("SMTP_FROM", "bot@localhost"))
+}
+
+// Send delivers a message, the address must already be validated
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(b.String()))
+}
@@ -0,0 +1,290 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// Actions available on held messages
+const (
+	premodApprove = "approve"
+	premodReject  = "reject"
+	premodBan     = "ban"
+)
+
+// PremodItem is a held message waiting for an admin decision
+type PremodItem struct {
+	ID        string    `json:"id"`
+	UserID    int64     `json:"user_id"`
+	User      string    `json:"user"`
+	ChatID    int64     `json:"chat_id"`
+	ChatTitle string    `json:"chat_title"`
+	Text      string    `json:"text,omitempty"`
+	CopyID    int       `json:"copy_id"`
+	Time      time.Time `json:"time"`
+}
+
+// premodQueue stores held messages backed by a JSON file in data/, messages no admin handled within ttl are dropped
+type premodQueue struct {
+	mu    sync.Mutex
+	Next  int                    `json:"next"`
+	Items map[string]*PremodItem `json:"items"`
+	limit int
+	ttl   time.Duration
+	file  string
+}
+
+// newPremodQueue creates the pre-moderation queue, limit is the number of approvals that grants trust
+func newPremodQueue(file string) *premodQueue {
+	_ = os.MkdirAll("data", 0755)
+	if !strings.HasPrefix(file, "data/") {
+		file = "data/" + file
+	}
+	q := &premodQueue{Items: make(map[string]*PremodItem), limit: envInt("PREMOD_MESSAGES", 3), ttl: envDuration("PREMOD_TTL", 7*24*time.Hour), file: file}
+	q.load()
+	return q
+}
+
+// prune drops held messages older than the TTL, the caller holds the lock
+func (q *premodQueue) prune(now time.Time) bool {
+	if q.ttl <= 0 {
+		return false
+	}
+	pruned := false
+	for id, item := range q.Items {
+		if now.Sub(item.Time) > q.ttl {
+			delete(q.Items, id)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// add stores a held message and returns its ID
+func (q *premodQueue) add(item PremodItem) string {
+	q.mu.Lock()
+	q.prune(item.Time)
+	q.Next++
+	item.ID = strconv.Itoa(q.Next)
+	q.Items[item.ID] = &item
+	q.mu.Unlock()
+	q.save()
+	return item.ID
+}
+
+// take removes and returns a held message
+func (q *premodQueue) take(id string) (PremodItem, bool) {
+	q.mu.Lock()
+	item, ok := q.Items[id]
+	delete(q.Items, id)
+	q.mu.Unlock()
+	if !ok {
+		return PremodItem{}, false
+	}
+	q.save()
+	return *item, true
+}
+
+// save persists the queue to disk
+func (q *premodQueue) save() {
+	q.mu.Lock()
+	data, err := json.MarshalIndent(q, "", "  ")
+	q.mu.Unlock()
+	if err != nil {
+		logrus.WithError(err).Error("premod marshal")
+		return
+	}
+	_ = os.WriteFile(q.file, data, 0644)
+}
+
+// load reads the queue from disk
+func (q *premodQueue) load() {
+	data, err := os.ReadFile(q.file)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, q)
+	if q.Items == nil {
+		q.Items = make(map[string]*PremodItem)
+	}
+	q.mu.Lock()
+	pruned := q.prune(time.Now())
+	q.mu.Unlock()
+	if pruned {
+		q.save()
+	}
+}
+
+// PremodButton returns the button routed to HandlePremod
+func PremodButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("premod", msgs.Premod.ApproveButton)
+}
+
+// startPremod puts a newly admitted user under pre-moderation
+func (fh *FeatureHandler) startPremod(user *tb.User) {
+	if fh.premod == nil || fh.premod.limit <= 0 || user == nil {
+		return
+	}
+	fh.state.StartPremod(int(user.ID))
+}
+
+// holdForPremod moves a message of a pre-moderated user to the admin chat, returns true if the message was held
+func (fh *FeatureHandler) holdForPremod(c tb.Context) bool {
+	msg := c.Message()
+	// Only group messages are moderated, private chats with the bot are nobody else's business
+	if fh.premod == nil || fh.premod.limit <= 0 || fh.adminHandler == nil || c.Chat().Type == tb.ChatPrivate || !fh.state.IsPremod(int(msg.Sender.ID)) {
+		return false
+	}
+
+	adminChat := &tb.Chat{ID: fh.adminChatID}
+	copied, err := fh.bot.Copy(adminChat, msg)
+	if err != nil {
+		// Leave the message in the group rather than lose it
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID}).Error("Failed to copy message for pre-moderation")
+		return false
+	}
+	if err := fh.bot.Delete(msg); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": c.Chat().ID, "message_id": msg.ID}).Warn("Failed to delete held message")
+	}
+
+	item := PremodItem{
+		UserID:    msg.Sender.ID,
+		User:      fh.adminHandler.GetUserDisplayName(msg.Sender),
+		ChatID:    c.Chat().ID,
+		ChatTitle: c.Chat().Title,
+		Text:      msg.Text,
+		CopyID:    copied.ID,
+		Time:      time.Now(),
+	}
+	id := fh.premod.add(item)
+
+	adminMsgs := i18n.Get().T(i18n.Get().GetDefault())
+	var row []tb.InlineButton
+	for _, action := range []string{premodApprove, premodReject, premodBan} {
+		btn := PremodButton()
+		btn.Text = premodActionLabel(adminMsgs, action)
+		btn.Data = action + "|" + id
+		row = append(row, btn)
+	}
+	logMsg := fmt.Sprintf("🕓 Сообщение на премодерации.\n\nПользователь: %s\nЧат: %s", item.User, item.ChatTitle)
+	opts := &tb.SendOptions{ReplyTo: copied, ReplyMarkup: &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{row}}}
+	if _, err := fh.bot.Send(adminChat, logMsg, opts); err != nil {
+		logrus.WithError(err).Error("Failed to send pre-moderation entry")
+	}
+
+	lang := fh.getLangForUser(msg.Sender)
+	msgs := i18n.Get().T(lang)
+	notice, _ := fh.bot.Send(c.Chat(), fmt.Sprintf(msgs.Premod.Held, item.User))
+	fh.adminHandler.DeleteAfter(notice, 15*time.Second)
+	logrus.WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": msg.Sender.ID, "item": id}).Info("Message held for pre-moderation")
+	return true
+}
+
+// premodActionLabel returns the button text of a pre-moderation action
+func premodActionLabel(msgs *i18n.Messages, action string) string {
+	switch action {
+	case premodApprove:
+		return msgs.Premod.ApproveButton
+	case premodReject:
+		return msgs.Premod.RejectButton
+	case premodBan:
+		return msgs.LogActions.Ban
+	}
+	return action
+}
+
+// HandlePremod applies an admin decision to a held message
+func (fh *FeatureHandler) HandlePremod(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	cb := c.Callback()
+	if cb == nil || c.Sender() == nil || c.Message() == nil {
+		return nil
+	}
+	if !fh.adminHandler.IsAdmin(&tb.Chat{ID: fh.adminChatID}, c.Sender()) {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Buttons.NotYourButton})
+		return nil
+	}
+	action, id, ok := strings.Cut(cb.Data, "|")
+	if !ok {
+		_ = fh.bot.Respond(cb)
+		return nil
+	}
+	item, ok := fh.premod.take(id)
+	if !ok {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.LogActions.Expired})
+		_, _ = fh.bot.EditReplyMarkup(c.Message(), nil)
+		return nil
+	}
+
+	adminMsgs := i18n.Get().T(i18n.Get().GetDefault())
+	user := &tb.User{ID: item.UserID}
+	chat := &tb.Chat{ID: item.ChatID}
+	if member, err := fh.bot.ChatMemberOf(chat, user); err == nil && member.User != nil {
+		user = member.User
+	}
+	note := fmt.Sprintf(adminMsgs.LogActions.DoneBy, premodActionLabel(adminMsgs, action), fh.adminHandler.GetUserDisplayName(c.Sender()))
+
+	switch action {
+	case premodApprove:
+		fh.repostApproved(chat, item)
+		fh.trainClassifier(item.Text, false)
+		fh.adminHandler.Audit(core.AuditPremodApproved, c.Sender(), user, item.ChatID, "premod", item.Text)
+		if fh.state.IncPremodApproved(int(item.UserID)) >= fh.premod.limit {
+			fh.state.ClearPremod(int(item.UserID))
+			note += "\n" + fmt.Sprintf("🤝 Пользователь %s больше не на премодерации.", item.User)
+		}
+	case premodReject:
+		fh.adminHandler.Audit(core.AuditPremodRejected, c.Sender(), user, item.ChatID, "premod", item.Text)
+	case premodBan:
+		fh.adminHandler.BanUserEverywhere(user, "premod", item.Text, c.Sender())
+		fh.trainClassifier(item.Text, true)
+		fh.adminHandler.ClearViolations(item.UserID)
+		fh.state.ClearPremod(int(item.UserID))
+		fh.adminHandler.Audit(core.AuditSpamBan, c.Sender(), user, item.ChatID, "premod", item.Text)
+	default:
+		_ = fh.bot.Respond(cb)
+		return nil
+	}
+
+	_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: note})
+	if _, err := fh.bot.Edit(c.Message(), c.Message().Text+"\n\n"+note); err != nil {
+		logrus.WithError(err).Warn("Failed to edit pre-moderation entry")
+	}
+	logrus.WithFields(logrus.Fields{"action": action, "user_id": item.UserID, "chat_id": item.ChatID, "admin_id": c.Sender().ID}).Info("Pre-moderation decision applied")
+	return nil
+}
+
+// repostApproved posts an approved message back to its group attributed to the author
+func (fh *FeatureHandler) repostApproved(chat *tb.Chat, item PremodItem) {
+	msgs := i18n.Get().T(i18n.Get().GetDefault())
+	if item.Text != "" {
+		if _, err := fh.bot.Send(chat, fmt.Sprintf(msgs.Premod.Reposted, item.User, item.Text)); err != nil {
+			logrus.WithError(err).WithField("chat_id", item.ChatID).Error("Failed to repost approved message")
+		}
+		return
+	}
+	header, err := fh.bot.Send(chat, fmt.Sprintf(msgs.Premod.RepostedMedia, item.User))
+	if err != nil {
+		logrus.WithError(err).WithField("chat_id", item.ChatID).Error("Failed to repost approved message")
+		return
+	}
+	stored := tb.StoredMessage{MessageID: strconv.Itoa(item.CopyID), ChatID: fh.adminChatID}
+	if _, err := fh.bot.Copy(chat, stored, &tb.SendOptions{ReplyTo: header}); err != nil {
+		logrus.WithError(err).WithField("chat_id", item.ChatID).Error("Failed to repost approved media")
+	}
+}
@@ -0,0 +1,29 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPremodQueueTTL(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("PREMOD_TTL", "1h")
+	q := newPremodQueue("premod.json")
+	now := time.Now()
+	old := q.add(PremodItem{UserID: 1, Time: now.Add(-2 * time.Hour)})
+	kept := q.add(PremodItem{UserID: 2, Time: now.Add(-30 * time.Minute)})
+	q.add(PremodItem{UserID: 3, Time: now})
+	if _, ok := q.Items[old]; ok {
+		t.Error("stale message kept when adding")
+	}
+
+	q.Items[kept].Time = now.Add(-90 * time.Minute)
+	q.save()
+	reloaded := newPremodQueue("premod.json")
+	if _, ok := reloaded.Items[kept]; ok {
+		t.Error("stale message kept on load")
+	}
+	if len(reloaded.Items) != 1 || reloaded.Next != 3 {
+		t.Errorf("queue after reload: %d items, next %d", len(reloaded.Items), reloaded.Next)
+	}
+}
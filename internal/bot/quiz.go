@@ -4,8 +4,18 @@ import (
 	"UEPB/internal/core"
 	"UEPB/internal/i18n"
 	"fmt"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
 	tb "gopkg.in/telebot.v4"
 )
 
@@ -14,6 +24,11 @@ func CreateInlineButton(unique, text string) tb.InlineButton {
 	return tb.InlineButton{Unique: unique, Text: text}
 }
 
+// QuizButton returns the button routing all quiz answers, its data is "user|question|option"
+func QuizButton() tb.InlineButton {
+	return CreateInlineButton("quiz", "")
+}
+
 // StudentButton returns student button
 func StudentButton() tb.InlineButton {
 	lang := i18n.Get().GetDefault()
@@ -35,99 +50,581 @@ func AdsButton() tb.InlineButton {
 	return CreateInlineButton("ads", msgs.Buttons.Ads)
 }
 
-// HandleStudent starts quiz
+// HandleStudent draws questions for the user and starts quiz
 func (fh *FeatureHandler) HandleStudent(c tb.Context) error {
-	fh.state.InitUser(int(c.Sender().ID))
-	questions := fh.quiz.GetQuestions()
-	if len(questions) > 0 {
-		q := questions[0]
-		_ = fh.SendOrEdit(c.Chat(), c.Message(), q.GetText(), &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{q.GetButtons()}})
+	group := fh.verifyChat(c)
+	if group == nil {
+		return fh.verifyExpired(c)
+	}
+	if fh.quiz.Policy(group.ID).Method == core.VerifyEmail {
+		if fh.email != nil && c.Chat().Type == tb.ChatPrivate {
+			fh.startEmailVerification(c, group)
+			return nil
+		}
+		logrus.WithField("chat_id", group.ID).Warn("E-mail verification is not available, using the quiz")
 	}
+	fh.startQuiz(c, group)
 	return nil
 }
 
-// RegisterQuizHandlers registers quiz buttons
-func (fh *FeatureHandler) RegisterQuizHandlers(bot *tb.Bot) {
-	questions := fh.quiz.GetQuestions()
-	for i, q := range questions {
-		for _, btn := range q.GetButtons() {
-			bot.Handle(&btn, fh.OnlyNewbies(fh.CreateQuizHandler(i, q, btn)))
+// startQuiz draws questions of the group for the user and shows the first one
+func (fh *FeatureHandler) startQuiz(c tb.Context, group *tb.Chat) {
+	// A button left from before the chat switched to a CAPTCHA leads to the challenge, such a chat may have no questions
+	if method := fh.quiz.Policy(group.ID).Method; verifiers[method] != nil {
+		fh.sendChallenge(c.Chat(), group, c.Sender(), method, "")
+		return
+	}
+	userID := int(c.Sender().ID)
+	fh.state.InitUser(userID)
+	questions, passScore := fh.quiz.NewPlan(group.ID)
+	fh.state.SetQuizPlan(userID, group.ID, questions, passScore)
+	plan, _ := fh.state.QuizPlan(userID)
+	fh.sendQuizQuestion(c, plan)
+}
+
+// verifyChat returns the group a verification step belongs to, in a private chat it comes from the button data or the quiz plan
+func (fh *FeatureHandler) verifyChat(c tb.Context) *tb.Chat {
+	if c.Chat().Type != tb.ChatPrivate {
+		return c.Chat()
+	}
+	var groupID int64
+	if cb := c.Callback(); cb != nil {
+		if id, err := strconv.ParseInt(cb.Data, 10, 64); err == nil {
+			groupID = id
 		}
 	}
+	if plan, ok := fh.state.QuizPlan(int(c.Sender().ID)); ok && groupID == 0 {
+		groupID = plan.GroupID
+	}
+	// Button data comes from the client, the group must have a pending verification of this user
+	if groupID == 0 || !fh.verify.has(groupID, c.Sender().ID) {
+		return nil
+	}
+	return &tb.Chat{ID: groupID, Type: tb.ChatSuperGroup}
+}
+
+// verifyExpired answers a button whose verification can't be continued
+func (fh *FeatureHandler) verifyExpired(c tb.Context) error {
+	msgs := i18n.Get().T(fh.getLangForUser(c.Sender()))
+	if cb := c.Callback(); cb != nil {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.LogActions.Expired})
+	}
+	return nil
 }
 
-// CreateQuizHandler builds handler for quiz button
-func (fh *FeatureHandler) CreateQuizHandler(i int, q core.QuestionInterface, btn tb.InlineButton) func(tb.Context) error {
-	return func(c tb.Context) error {
-		lang := fh.getLangForUser(c.Sender())
-		msgs := i18n.Get().T(lang)
+// sendQuizQuestion shows the current question of the plan in the user's quiz message, returns false if it no longer exists
+func (fh *FeatureHandler) sendQuizQuestion(c tb.Context, plan core.QuizPlan) bool {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if plan.Step >= len(plan.Questions) {
+		return false
+	}
+	q, ok := fh.quiz.GetQuestion(plan.GroupID, string(lang), plan.Questions[plan.Step])
+	if !ok {
+		return false
+	}
+	buttons := q.GetButtons()
+	for i := range buttons {
+		buttons[i].Data = ownerData(c.Sender().ID, buttons[i].Data)
+	}
+	// The first question replaces the message with the pressed button, later ones edit the quiz message of this user
+	var target *tb.Message
+	if plan.MessageID != 0 {
+		target = &tb.Message{ID: plan.MessageID, Chat: &tb.Chat{ID: plan.ChatID}}
+	} else if c.Callback() != nil {
+		target = c.Message()
+	}
+	text := fmt.Sprintf(msgs.Quiz.Progress, plan.Step+1, len(plan.Questions)) + "\n\n" + q.GetText()
+	if msg := fh.SendOrEdit(c.Chat(), target, text, &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{buttons}}); msg != nil && msg.ID != plan.MessageID {
+		fh.state.SetQuizMessage(int(c.Sender().ID), msg.Chat.ID, msg.ID)
+	}
+	return true
+}
+
+// RegisterQuizHandlers registers the quiz answer, retry and CAPTCHA buttons, questions and options are carried in the data
+func (fh *FeatureHandler) RegisterQuizHandlers(bot *tb.Bot) {
+	btn, retry, captcha := QuizButton(), QuizRetryButton(), CaptchaButton()
+	bot.Handle(&btn, fh.OnlyNewbies(fh.HandleQuizAnswer))
+	bot.Handle(&retry, fh.OnlyNewbies(fh.HandleQuizRetry))
+	bot.Handle(&captcha, fh.OnlyNewbies(fh.HandleCaptchaAnswer))
+}
+
+// HandleQuizAnswer counts an answer and shows the next question or the result
+func (fh *FeatureHandler) HandleQuizAnswer(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	cb := c.Callback()
+	if cb == nil {
+		return nil
+	}
+	userID := int(c.Sender().ID)
+	group := fh.verifyChat(c)
+	if group == nil {
+		return fh.verifyExpired(c)
+	}
+	qid, option, _ := strings.Cut(cb.Data, "|")
+	q, ok := fh.quiz.GetQuestion(group.ID, string(lang), qid)
+	if !ok {
+		// The question was removed by a reload, the user starts over with a fresh draw
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.LogActions.Expired})
+		fh.startQuiz(c, group)
+		return nil
+	}
+	if plan, ok := fh.state.QuizPlan(userID); ok && plan.MessageID != 0 && (c.Message() == nil || c.Message().ID != plan.MessageID) {
+		// A keyboard of an older quiz message
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.LogActions.Expired})
+		return nil
+	}
+	plan, ok := fh.state.AdvanceQuiz(userID, qid)
+	if !ok {
+		// Not the current question of this user, e.g. a double tap
+		_ = fh.bot.Respond(cb)
+		return nil
+	}
+	if option == q.GetAnswer() {
+		fh.state.IncCorrect(userID)
+	}
+	_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: q.GetExplanation()})
 
-		userID := int(c.Sender().ID)
-		if btn.Unique == q.GetAnswer() {
-			fh.state.IncCorrect(userID)
+	if plan.Step < len(plan.Questions) {
+		if !fh.sendQuizQuestion(c, plan) {
+			fh.startQuiz(c, group)
 		}
-		questions := fh.quiz.GetQuestions()
-		if i+1 < len(questions) {
-			next := questions[i+1]
-			_ = fh.SendOrEdit(c.Chat(), c.Message(), next.GetText(), &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{next.GetButtons()}})
-			return nil
+		return nil
+	}
+	totalCorrect := fh.state.TotalCorrect(userID)
+	totalQuestions := len(plan.Questions)
+	passScore := plan.PassScore
+	if passScore == 0 {
+		// A plan stored before pass scores were kept in it
+		passScore = min(fh.quiz.PassScore(group.ID), totalQuestions)
+	}
+	if totalCorrect >= passScore {
+		fh.SetUserRestriction(group, c.Sender(), true)
+		fh.state.ClearNewbie(userID)
+		fh.state.ClearQuizFails(group.ID, userID)
+		fh.verificationDone(group, c.Sender())
+		fh.startPremod(c.Sender())
+		msg := fh.SendOrEdit(c.Chat(), c.Message(), msgs.Quiz.VerificationPassed, nil)
+		if fh.adminHandler != nil {
+			fh.adminHandler.DeleteAfter(msg, 5*time.Second)
 		}
-		totalCorrect := fh.state.TotalCorrect(userID)
-		totalQuestions := len(questions)
-		if totalCorrect >= 2 {
-			fh.SetUserRestriction(c.Chat(), c.Sender(), true)
-			fh.state.ClearNewbie(userID)
-			msg := fh.SendOrEdit(c.Chat(), c.Message(), msgs.Quiz.VerificationPassed, nil)
-			if fh.adminHandler != nil {
-				fh.adminHandler.DeleteAfter(msg, 5*time.Second)
-			}
-			logMsg := fmt.Sprintf("✅ Пользователь успешно прошёл верификацию.\n\nПользователь: %s\nПравильных ответов: %d/%d", fh.adminHandler.GetUserDisplayName(c.Sender()), totalCorrect, totalQuestions)
-			fh.adminHandler.LogToAdmin(logMsg)
-		} else {
-			msg := fh.SendOrEdit(c.Chat(), c.Message(), msgs.Quiz.VerificationFailed, nil)
-			if fh.adminHandler != nil {
-				fh.adminHandler.DeleteAfter(msg, 5*time.Second)
-			}
-			logMsg := fmt.Sprintf("❌ Пользователь не прошёл верификацию.\n\nПользователь: %s\nПравильных ответов: %d/%d", fh.adminHandler.GetUserDisplayName(c.Sender()), totalCorrect, totalQuestions)
-			fh.adminHandler.LogToAdmin(logMsg)
+		logMsg := fmt.Sprintf("✅ Пользователь успешно прошёл верификацию.\n\nПользователь: %s\nПравильных ответов: %d/%d", fh.adminHandler.GetUserDisplayName(c.Sender()), totalCorrect, totalQuestions)
+		fh.adminHandler.LogToAdmin(logMsg)
+		fh.adminHandler.Audit(core.AuditQuizPassed, nil, c.Sender(), group.ID, "quiz", fmt.Sprintf("%d/%d", totalCorrect, totalQuestions))
+	} else {
+		fh.quizFailed(c, group, totalCorrect, totalQuestions)
+	}
+	fh.state.Reset(userID)
+	return nil
+}
+
+// QuizRetryButton returns the button starting another quiz attempt
+func QuizRetryButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("quiz_retry", msgs.Quiz.RetryButton)
+}
+
+// quizFailed offers another attempt after the cooldown or applies the chat policy once attempts run out
+func (fh *FeatureHandler) quizFailed(c tb.Context, group *tb.Chat, totalCorrect, totalQuestions int) {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	user := c.Sender()
+	name := fh.adminHandler.GetUserDisplayName(user)
+	policy := fh.quiz.Policy(group.ID)
+	attempts := fh.state.AddQuizFail(group.ID, int(user.ID), time.Now(), policy.FailTTL)
+	fh.adminHandler.Audit(core.AuditQuizFailed, nil, user, group.ID, "quiz", fmt.Sprintf("%d/%d, attempt %d/%d", totalCorrect, totalQuestions, attempts, policy.Attempts))
+
+	if attempts < policy.Attempts {
+		// The deadline restarts after the cooldown so the next attempt gets the full time
+		welcome := c.Message()
+		if c.Chat().Type == tb.ChatPrivate {
+			welcome = nil
 		}
-		fh.state.Reset(userID)
+		fh.startVerification(group, user, welcome, policy.Cooldown)
+		retry := QuizRetryButton()
+		retry.Text = msgs.Quiz.RetryButton
+		retry.Data = ownerData(user.ID, strconv.FormatInt(group.ID, 10))
+		minutes := int(policy.Cooldown.Round(time.Minute).Minutes())
+		text := msgs.Quiz.VerificationFailed + "\n\n" + fmt.Sprintf(msgs.Quiz.RetryIn, max(minutes, 1), policy.Attempts-attempts)
+		_ = fh.SendOrEdit(c.Chat(), c.Message(), text, &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{retry}}})
+		logMsg := fmt.Sprintf("❌ Пользователь не прошёл верификацию.\n\nПользователь: %s\nПравильных ответов: %d/%d\nПопытка: %d из %d, следующая через %s", name, totalCorrect, totalQuestions, attempts, policy.Attempts, policy.Cooldown)
+		fh.adminHandler.LogToAdmin(logMsg)
+		return
+	}
+
+	fh.state.ClearNewbie(int(user.ID))
+	fh.verificationDone(group, user)
+	if policy.OnFail == core.QuizFailGuest {
+		fh.SetUserRestriction(group, user, true)
+		fh.startPremod(user)
+		msg := fh.SendOrEdit(c.Chat(), c.Message(), msgs.Quiz.VerificationFailed+"\n\n"+msgs.Guest.CanWrite, nil)
+		fh.adminHandler.DeleteAfter(msg, 10*time.Second)
+		logMsg := fmt.Sprintf("❌ Пользователь исчерпал попытки верификации и переведён в гостевой режим.\n\nПользователь: %s\nПравильных ответов: %d/%d\nПопыток: %d", name, totalCorrect, totalQuestions, attempts)
+		fh.logWithActions(logMsg, user, group.ID, "", LogActionRequiz, LogActionBan)
+		fh.adminHandler.Audit(core.AuditGuest, nil, user, group.ID, "quiz attempts", "")
+		return
+	}
+
+	msg := fh.SendOrEdit(c.Chat(), c.Message(), fmt.Sprintf(msgs.Quiz.FailedKicked, name), nil)
+	fh.adminHandler.DeleteAfter(msg, 30*time.Second)
+	if err := fh.kickUser(group, user); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": group.ID, "user_id": user.ID}).Error("Failed to kick user after quiz attempts")
+	}
+	logMsg := fmt.Sprintf("❌ Пользователь исчерпал попытки верификации и удалён из чата.\n\nПользователь: %s\nПравильных ответов: %d/%d\nПопыток: %d", name, totalCorrect, totalQuestions, attempts)
+	fh.logWithActions(logMsg, user, group.ID, "", LogActionBan)
+}
+
+// HandleQuizRetry starts another attempt once the cooldown has passed
+func (fh *FeatureHandler) HandleQuizRetry(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	group := fh.verifyChat(c)
+	if group == nil {
+		return fh.verifyExpired(c)
+	}
+	policy := fh.quiz.Policy(group.ID)
+	attempts, last := fh.state.LastQuizFail(group.ID, int(c.Sender().ID))
+	if attempts >= policy.Attempts {
+		_ = fh.bot.Respond(c.Callback(), &tb.CallbackResponse{Text: msgs.LogActions.Expired})
 		return nil
 	}
+	if wait := time.Until(last.Add(policy.Cooldown)); wait > 0 {
+		_ = fh.bot.Respond(c.Callback(), &tb.CallbackResponse{Text: fmt.Sprintf(msgs.Quiz.RetryWait, int(wait.Seconds())+1), ShowAlert: true})
+		return nil
+	}
+	_ = fh.bot.Respond(c.Callback())
+	fh.startQuiz(c, group)
+	return nil
 }
 
-// Question holds quiz data
+// Question is a quiz question localized for one language
 type Question struct {
-	Text    string
-	Buttons []tb.InlineButton
-	Answer  string
+	ID          string
+	Text        string
+	Buttons     []tb.InlineButton
+	Answer      string
+	Explanation string
 }
 
+func (q Question) GetID() string                 { return q.ID }
 func (q Question) GetText() string               { return q.Text }
 func (q Question) GetButtons() []tb.InlineButton { return q.Buttons }
 func (q Question) GetAnswer() string             { return q.Answer }
+func (q Question) GetExplanation() string        { return q.Explanation }
 
-// Quiz holds questions
-type Quiz struct{ Questions []Question }
+// quizOption is an answer option in the quiz file
+type quizOption struct {
+	ID   string            `toml:"id"`
+	Text map[string]string `toml:"text"`
+}
+
+// quizQuestion is a question in the quiz file
+type quizQuestion struct {
+	ID          string            `toml:"id"`
+	Text        map[string]string `toml:"text"`
+	Options     []quizOption      `toml:"option"`
+	Answer      string            `toml:"answer"`
+	Explanation map[string]string `toml:"explanation"`
+}
 
-func (quiz Quiz) GetQuestions() []core.QuestionInterface {
-	list := make([]core.QuestionInterface, len(quiz.Questions))
-	for i, qq := range quiz.Questions {
-		list[i] = qq
+// quizSet is the quiz of a chat, Ask questions are drawn from the pool, all of them if it is 0
+//
+// Method, Attempts, RetryCooldown, OnFail and Private override the policy from the environment when set.
+type quizSet struct {
+	Method        string         `toml:"method"`
+	Ask           int            `toml:"ask"`
+	PassScore     int            `toml:"pass_score"`
+	Attempts      int            `toml:"attempts"`
+	RetryCooldown string         `toml:"retry_cooldown"`
+	OnFail        string         `toml:"on_fail"`
+	Private       *bool          `toml:"private"`
+	Questions     []quizQuestion `toml:"question"`
+}
+
+// asked returns the number of questions drawn for a user
+func (set quizSet) asked() int {
+	if set.Ask <= 0 || set.Ask > len(set.Questions) {
+		return len(set.Questions)
 	}
-	return list
+	return set.Ask
 }
 
-// DefaultQuiz returns default quiz
-func DefaultQuiz() core.QuizInterface {
-	lang := i18n.Get().GetDefault()
-	msgs := i18n.Get().T(lang)
+// quizFile is the layout of the quiz file
+type quizFile struct {
+	Default quizSet            `toml:"default"`
+	Chats   map[string]quizSet `toml:"chats"`
+}
+
+// quizIDPattern keeps IDs short enough for callback data
+var quizIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,16}$`)
 
-	return Quiz{Questions: []Question{
-		{msgs.Quiz.Question1, []tb.InlineButton{{Unique: "q1_usos", Text: "USOS"}, {Unique: "q1_edupl", Text: "EDUPL"}, {Unique: "q1_muci", Text: "MUCI"}}, "q1_usos"},
-		{msgs.Quiz.Question2, []tb.InlineButton{{Unique: "q2_gmail", Text: "Gmail"}, {Unique: "q2_outlook", Text: "Outlook"}, {Unique: "q2_yahoo", Text: "Yahoo"}}, "q2_outlook"},
-		{msgs.Quiz.Question3, []tb.InlineButton{{Unique: "q3_niepodleglosci", Text: "Ul. Niepodległości"}, {Unique: "q3_chinska", Text: "Ul. Chińska"}, {Unique: "q3_roz", Text: "Ul. Róż"}}, "q3_niepodleglosci"},
+// Quiz holds quizzes loaded from a TOML file and reloads them when the file changes
+type Quiz struct {
+	mu      sync.RWMutex
+	path    string
+	modTime time.Time
+	def     quizSet
+	chats   map[int64]quizSet
+	policy  core.QuizPolicy
+}
+
+// NewQuiz loads and validates the quiz file and starts watching it for changes
+func NewQuiz(path string) (core.QuizInterface, error) {
+	q := &Quiz{path: path, policy: core.QuizPolicy{
+		Method:   envString("VERIFY_METHOD", core.VerifyQuiz),
+		Attempts: envInt("QUIZ_ATTEMPTS", 3),
+		Cooldown: envDuration("QUIZ_RETRY_COOLDOWN", time.Minute),
+		FailTTL:  envDuration("QUIZ_FAIL_TTL", 24*time.Hour),
+		OnFail:   envString("QUIZ_ON_FAIL", core.QuizFailKick),
+		Private:  envBool("QUIZ_PRIVATE", false),
 	}}
+	if q.policy.OnFail != core.QuizFailGuest && q.policy.OnFail != core.QuizFailKick {
+		return nil, fmt.Errorf("QUIZ_ON_FAIL must be %q or %q", core.QuizFailGuest, core.QuizFailKick)
+	}
+	if !validMethod(q.policy.Method) {
+		return nil, fmt.Errorf("VERIFY_METHOD must be one of %s", strings.Join(verifyMethods(), ", "))
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	go q.watch(envDuration("QUIZ_RELOAD", 30*time.Second))
+	return q, nil
+}
+
+// load reads and validates the quiz file, the current quiz is kept on error
+func (q *Quiz) load() error {
+	info, err := os.Stat(q.path)
+	if err != nil {
+		return err
+	}
+	var f quizFile
+	if _, err := toml.DecodeFile(q.path, &f); err != nil {
+		return err
+	}
+	if err := validateQuizSet(f.Default); err != nil {
+		return fmt.Errorf("%s: default: %w", q.path, err)
+	}
+	chats := make(map[int64]quizSet, len(f.Chats))
+	for key, set := range f.Chats {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: chats.%s: invalid chat ID", q.path, key)
+		}
+		if err := validateQuizSet(set); err != nil {
+			return fmt.Errorf("%s: chats.%s: %w", q.path, key, err)
+		}
+		chats[id] = set
+	}
+
+	q.mu.Lock()
+	q.modTime = info.ModTime()
+	q.def = f.Default
+	q.chats = chats
+	q.mu.Unlock()
+	return nil
+}
+
+// watch reloads the quiz file when its modification time changes
+func (q *Quiz) watch(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		info, err := os.Stat(q.path)
+		if err != nil {
+			continue
+		}
+		q.mu.RLock()
+		changed := !info.ModTime().Equal(q.modTime)
+		q.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := q.load(); err != nil {
+			// Remember the broken version so the error is logged once
+			q.mu.Lock()
+			q.modTime = info.ModTime()
+			q.mu.Unlock()
+			logrus.WithError(err).Error("Quiz reload failed, keeping the previous quiz")
+			continue
+		}
+		logrus.WithField("path", q.path).Info("Quiz reloaded")
+	}
+}
+
+// validateQuizSet checks IDs, texts, options and the pass score of a quiz
+func validateQuizSet(set quizSet) error {
+	// A chat verified with a CAPTCHA asks no questions, so it needs no quiz
+	if _, captcha := verifiers[set.Method]; !captcha {
+		if len(set.Questions) == 0 {
+			return fmt.Errorf("no questions")
+		}
+		if set.Ask < 0 || set.Ask > len(set.Questions) {
+			return fmt.Errorf("ask must be between 0 and %d", len(set.Questions))
+		}
+		if set.PassScore < 1 || set.PassScore > set.asked() {
+			return fmt.Errorf("pass_score must be between 1 and %d", set.asked())
+		}
+	}
+	if set.Attempts < 0 {
+		return fmt.Errorf("attempts must not be negative")
+	}
+	if set.RetryCooldown != "" {
+		if _, err := parseDuration(set.RetryCooldown); err != nil {
+			return fmt.Errorf("retry_cooldown: %w", err)
+		}
+	}
+	if set.OnFail != "" && set.OnFail != core.QuizFailGuest && set.OnFail != core.QuizFailKick {
+		return fmt.Errorf("on_fail must be %q or %q", core.QuizFailGuest, core.QuizFailKick)
+	}
+	if set.Method != "" && !validMethod(set.Method) {
+		return fmt.Errorf("method must be one of %s", strings.Join(verifyMethods(), ", "))
+	}
+	seen := make(map[string]bool)
+	for i, qq := range set.Questions {
+		if !quizIDPattern.MatchString(qq.ID) {
+			return fmt.Errorf("question %d: invalid id %q", i+1, qq.ID)
+		}
+		if seen[qq.ID] {
+			return fmt.Errorf("question %d: duplicate id %q", i+1, qq.ID)
+		}
+		seen[qq.ID] = true
+		if err := validateQuizText(qq.Text, true); err != nil {
+			return fmt.Errorf("question %s: text: %w", qq.ID, err)
+		}
+		if err := validateQuizText(qq.Explanation, false); err != nil {
+			return fmt.Errorf("question %s: explanation: %w", qq.ID, err)
+		}
+		if len(qq.Options) < 2 {
+			return fmt.Errorf("question %s: at least 2 options are required", qq.ID)
+		}
+		options := make(map[string]bool)
+		for _, o := range qq.Options {
+			if !quizIDPattern.MatchString(o.ID) || options[o.ID] {
+				return fmt.Errorf("question %s: invalid or duplicate option id %q", qq.ID, o.ID)
+			}
+			options[o.ID] = true
+			if err := validateQuizText(o.Text, true); err != nil {
+				return fmt.Errorf("question %s: option %s: %w", qq.ID, o.ID, err)
+			}
+		}
+		if !options[qq.Answer] {
+			return fmt.Errorf("question %s: answer %q is not an option", qq.ID, qq.Answer)
+		}
+	}
+	return nil
+}
+
+// validateQuizText checks that localized texts use known languages
+func validateQuizText(texts map[string]string, required bool) error {
+	if required && len(texts) == 0 {
+		return fmt.Errorf("missing")
+	}
+	for lang, t := range texts {
+		if !slices.Contains(i18n.Languages, i18n.Lang(lang)) {
+			return fmt.Errorf("unknown language %q", lang)
+		}
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("empty %s text", lang)
+		}
+	}
+	return nil
+}
+
+// localize picks the text for a language, falling back to the default one and then to any
+func localize(texts map[string]string, lang string) string {
+	if t, ok := texts[lang]; ok {
+		return t
+	}
+	if t, ok := texts[string(i18n.Get().GetDefault())]; ok {
+		return t
+	}
+	keys := make([]string, 0, len(texts))
+	for k := range texts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return ""
+	}
+	return texts[keys[0]]
 }
 
-var _ = time.Now
+// set returns the quiz of a chat
+func (q *Quiz) set(chatID int64) quizSet {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if set, ok := q.chats[chatID]; ok {
+		return set
+	}
+	return q.def
+}
+
+// NewPlan draws question IDs for a user in random order and returns the pass score of the same quiz version
+func (q *Quiz) NewPlan(chatID int64) ([]string, int) {
+	set := q.set(chatID)
+	ids := make([]string, 0, set.asked())
+	for _, i := range rand.Perm(len(set.Questions))[:set.asked()] {
+		ids = append(ids, set.Questions[i].ID)
+	}
+	return ids, set.PassScore
+}
+
+// GetQuestion returns a question of a chat localized for a language with options in random order
+func (q *Quiz) GetQuestion(chatID int64, lang, id string) (core.QuestionInterface, bool) {
+	set := q.set(chatID)
+	i := slices.IndexFunc(set.Questions, func(qq quizQuestion) bool { return qq.ID == id })
+	if i < 0 {
+		return nil, false
+	}
+	qq := set.Questions[i]
+	buttons := make([]tb.InlineButton, len(qq.Options))
+	for j, o := range qq.Options {
+		btn := QuizButton()
+		btn.Text = localize(o.Text, lang)
+		btn.Data = qq.ID + "|" + o.ID
+		buttons[j] = btn
+	}
+	rand.Shuffle(len(buttons), func(a, b int) { buttons[a], buttons[b] = buttons[b], buttons[a] })
+	return Question{ID: qq.ID, Text: localize(qq.Text, lang), Buttons: buttons, Answer: qq.Answer, Explanation: localize(qq.Explanation, lang)}, true
+}
+
+// PassScore returns the number of correct answers needed to pass in a chat
+func (q *Quiz) PassScore(chatID int64) int {
+	return q.set(chatID).PassScore
+}
+
+// Policy returns the verification policy of a chat, e-mail codes are always entered in a private chat
+func (q *Quiz) Policy(chatID int64) core.QuizPolicy {
+	set := q.set(chatID)
+	p := q.policy
+	if set.Method != "" {
+		p.Method = set.Method
+	}
+	if set.Attempts > 0 {
+		p.Attempts = set.Attempts
+	}
+	if d, err := parseDuration(set.RetryCooldown); err == nil {
+		p.Cooldown = d
+	}
+	if set.OnFail != "" {
+		p.OnFail = set.OnFail
+	}
+	if set.Private != nil {
+		p.Private = *set.Private
+	}
+	if p.Method == core.VerifyEmail {
+		p.Private = true
+	}
+	// Attempts must outlive the cooldown, otherwise every retry would start from zero
+	p.FailTTL = max(p.FailTTL, p.Cooldown)
+	return p
+}
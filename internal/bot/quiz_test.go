@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"UEPB/internal/core"
+)
+
+// testQuizSet returns a valid quiz with two questions
+func testQuizSet() quizSet {
+	question := func(id string) quizQuestion {
+		return quizQuestion{
+			ID:     id,
+			Text:   map[string]string{"en": "Question " + id},
+			Answer: "a",
+			Options: []quizOption{
+				{ID: "a", Text: map[string]string{"en": "A"}},
+				{ID: "b", Text: map[string]string{"en": "B"}},
+			},
+		}
+	}
+	return quizSet{Ask: 2, PassScore: 1, Questions: []quizQuestion{question("q1"), question("q2")}}
+}
+
+func TestValidateQuizSet(t *testing.T) {
+	if err := validateQuizSet(testQuizSet()); err != nil {
+		t.Fatalf("valid quiz rejected: %v", err)
+	}
+	for _, method := range []string{core.VerifyArithmetic, core.VerifyEmoji, core.VerifyImage} {
+		if err := validateQuizSet(quizSet{Method: method}); err != nil {
+			t.Errorf("%s chat without questions rejected: %v", method, err)
+		}
+	}
+	tests := map[string]func(set *quizSet){
+		"no questions":        func(set *quizSet) { set.Questions = nil },
+		"ask too high":        func(set *quizSet) { set.Ask = 3 },
+		"pass score zero":     func(set *quizSet) { set.PassScore = 0 },
+		"pass score too high": func(set *quizSet) { set.Ask, set.PassScore = 1, 2 },
+		"negative attempts":   func(set *quizSet) { set.Attempts = -1 },
+		"bad cooldown":        func(set *quizSet) { set.RetryCooldown = "soon" },
+		"bad on_fail":         func(set *quizSet) { set.OnFail = "mute" },
+		"bad method":          func(set *quizSet) { set.Method = "sms" },
+		"email no questions":  func(set *quizSet) { set.Method, set.Questions = core.VerifyEmail, nil },
+		"bad id":              func(set *quizSet) { set.Questions[0].ID = "Q 1" },
+		"duplicate id":        func(set *quizSet) { set.Questions[1].ID = "q1" },
+		"missing text":        func(set *quizSet) { set.Questions[0].Text = nil },
+		"unknown language":    func(set *quizSet) { set.Questions[0].Text = map[string]string{"de": "Frage"} },
+		"empty text":          func(set *quizSet) { set.Questions[0].Text = map[string]string{"en": " "} },
+		"one option":          func(set *quizSet) { set.Questions[0].Options = set.Questions[0].Options[:1] },
+		"duplicate option":    func(set *quizSet) { set.Questions[0].Options[1].ID = "a" },
+		"answer not option":   func(set *quizSet) { set.Questions[0].Answer = "c" },
+	}
+	for name, mutate := range tests {
+		set := testQuizSet()
+		mutate(&set)
+		if err := validateQuizSet(set); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+const testQuizFile = `
+[default]
+pass_score = 1
+
+[[default.question]]
+id = "q1"
+answer = "a"
+text.en = "Question"
+
+[[default.question.option]]
+id = "a"
+text.en = "A"
+
+[[default.question.option]]
+id = "b"
+text.en = "B"
+`
+
+// writeQuiz writes a quiz file into a temporary directory
+func writeQuiz(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "quiz.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestQuizLoad(t *testing.T) {
+	q := &Quiz{path: writeQuiz(t, testQuizFile)}
+	if err := q.load(); err != nil {
+		t.Fatalf("valid file rejected: %v", err)
+	}
+	questions, passScore := q.NewPlan(-100)
+	if len(questions) != 1 || passScore != 1 {
+		t.Fatalf("NewPlan = %v, %d", questions, passScore)
+	}
+}
+
+func TestQuizLoadCaptchaChat(t *testing.T) {
+	q := &Quiz{path: writeQuiz(t, testQuizFile+"\n[chats.\"-100\"]\nmethod = \"emoji\"\n")}
+	if err := q.load(); err != nil {
+		t.Fatalf("CAPTCHA chat without questions rejected: %v", err)
+	}
+	if method := q.Policy(-100).Method; method != core.VerifyEmoji {
+		t.Errorf("method %q", method)
+	}
+}
+
+func TestQuizLoadBadFiles(t *testing.T) {
+	tests := map[string]string{
+		"syntax":          "[default\n",
+		"invalid default": strings.Replace(testQuizFile, `answer = "a"`, `answer = "c"`, 1),
+		"chat id":         testQuizFile + "\n[chats.main]\npass_score = 1\n",
+		"invalid chat":    testQuizFile + "\n[chats.\"-100\"]\npass_score = 1\n",
+	}
+	for name, content := range tests {
+		q := &Quiz{path: writeQuiz(t, content)}
+		if err := q.load(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if err := (&Quiz{path: filepath.Join(t.TempDir(), "missing.toml")}).load(); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestQuizReloadKeepsPrevious(t *testing.T) {
+	path := writeQuiz(t, testQuizFile)
+	q := &Quiz{path: path}
+	if err := q.load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("[default]\npass_score = 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.load(); err == nil {
+		t.Fatal("broken reload accepted")
+	}
+	if questions, _ := q.NewPlan(-100); len(questions) != 1 {
+		t.Fatalf("previous quiz lost: %v", questions)
+	}
+}
@@ -0,0 +1,342 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+const (
+	lockdownCheckInterval = 30 * time.Second
+	// lockdownWelcomeInterval paces the welcomes sent after a lockdown, Telegram limits messages per group
+	lockdownWelcomeInterval = 3 * time.Second
+)
+
+// Lockdown is an active raid lockdown of a chat
+type Lockdown struct {
+	ChatID     int64     `json:"chat_id"`
+	Title      string    `json:"title"`
+	Since      time.Time `json:"since"`
+	LastJoin   time.Time `json:"last_join"`
+	Joined     int       `json:"joined"`
+	Joiners    []int64   `json:"joiners,omitempty"`
+	InviteLink string    `json:"invite_link,omitempty"`
+	AlertID    int       `json:"alert_id"`
+}
+
+// raidGuard detects join bursts and keeps lockdowns backed by a JSON file in data/
+type raidGuard struct {
+	mu        sync.Mutex
+	joins     map[int64][]time.Time
+	seen      map[string]time.Time
+	lockdowns map[int64]*Lockdown
+	file      string
+
+	enabled      bool
+	threshold    int
+	window       time.Duration
+	quiet        time.Duration
+	joinRequests bool
+}
+
+// newRaidGuard creates the raid guard configured from the environment
+func newRaidGuard(file string) *raidGuard {
+	_ = os.MkdirAll("data", 0755)
+	if !strings.HasPrefix(file, "data/") {
+		file = "data/" + file
+	}
+	rg := &raidGuard{
+		joins:        make(map[int64][]time.Time),
+		seen:         make(map[string]time.Time),
+		lockdowns:    make(map[int64]*Lockdown),
+		file:         file,
+		enabled:      envBool("RAID_ENABLED", true),
+		threshold:    envInt("RAID_JOINS", 10),
+		window:       envDuration("RAID_WINDOW", 2*time.Minute),
+		quiet:        envDuration("RAID_QUIET", 10*time.Minute),
+		joinRequests: envBool("RAID_JOIN_REQUESTS", false),
+	}
+	rg.load()
+	return rg
+}
+
+// firstJoin reports whether a join of the service message wasn't processed yet, telebot may deliver one message per joined user
+func (rg *raidGuard) firstJoin(chatID int64, msgID int, userID int64, now time.Time) bool {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	for k, t := range rg.seen {
+		if now.Sub(t) > time.Minute {
+			delete(rg.seen, k)
+		}
+	}
+	key := fmt.Sprintf("%d:%d:%d", chatID, msgID, userID)
+	if _, ok := rg.seen[key]; ok {
+		return false
+	}
+	rg.seen[key] = now
+	return true
+}
+
+// recordJoin counts a join and returns the lockdown of the chat, started is true if this join triggered it
+func (rg *raidGuard) recordJoin(chat *tb.Chat, userID int64, now time.Time) (ld *Lockdown, started bool) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	if ld, ok := rg.lockdowns[chat.ID]; ok {
+		ld.LastJoin = now
+		ld.Joined++
+		ld.Joiners = append(ld.Joiners, userID)
+		return ld, false
+	}
+	if !rg.enabled || rg.threshold <= 0 {
+		return nil, false
+	}
+	since := now.Add(-rg.window)
+	kept := rg.joins[chat.ID][:0]
+	for _, t := range rg.joins[chat.ID] {
+		if t.After(since) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+	rg.joins[chat.ID] = kept
+	if len(kept) < rg.threshold {
+		return nil, false
+	}
+	delete(rg.joins, chat.ID)
+	ld = &Lockdown{ChatID: chat.ID, Title: chat.Title, Since: now, LastJoin: now, Joined: 1, Joiners: []int64{userID}}
+	rg.lockdowns[chat.ID] = ld
+	return ld, true
+}
+
+// update changes a lockdown under the lock and persists it
+func (rg *raidGuard) update(chatID int64, fn func(ld *Lockdown)) {
+	rg.mu.Lock()
+	if ld, ok := rg.lockdowns[chatID]; ok {
+		fn(ld)
+	}
+	rg.mu.Unlock()
+	rg.save()
+}
+
+// end removes and returns the lockdown of a chat
+func (rg *raidGuard) end(chatID int64) (Lockdown, bool) {
+	rg.mu.Lock()
+	ld, ok := rg.lockdowns[chatID]
+	delete(rg.lockdowns, chatID)
+	rg.mu.Unlock()
+	if !ok {
+		return Lockdown{}, false
+	}
+	rg.save()
+	return *ld, true
+}
+
+// quietChats returns chats whose lockdown saw no joins for the quiet period
+func (rg *raidGuard) quietChats(now time.Time) []int64 {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	var ids []int64
+	for id, ld := range rg.lockdowns {
+		if now.Sub(ld.LastJoin) >= rg.quiet {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// migrate moves a lockdown to the new chat ID
+func (rg *raidGuard) migrate(from, to int64) {
+	rg.mu.Lock()
+	ld, ok := rg.lockdowns[from]
+	if ok {
+		ld.ChatID = to
+		rg.lockdowns[to] = ld
+		delete(rg.lockdowns, from)
+	}
+	rg.mu.Unlock()
+	if ok {
+		rg.save()
+	}
+}
+
+// save persists lockdowns to disk
+func (rg *raidGuard) save() {
+	rg.mu.Lock()
+	data, err := json.MarshalIndent(rg.lockdowns, "", "  ")
+	rg.mu.Unlock()
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(rg.file, data, 0644)
+}
+
+// load reads lockdowns from disk
+func (rg *raidGuard) load() {
+	data, err := os.ReadFile(rg.file)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, &rg.lockdowns)
+	if rg.lockdowns == nil {
+		rg.lockdowns = make(map[int64]*Lockdown)
+	}
+}
+
+// LockdownEndButton returns the button ending a raid lockdown
+func LockdownEndButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("lockdown_end", msgs.LogActions.EndLockdown)
+}
+
+// lockdownJoin handles a join during a raid, returns true if the user was silently restricted
+func (fh *FeatureHandler) lockdownJoin(chat *tb.Chat, u *tb.User) bool {
+	ld, started := fh.raid.recordJoin(chat, u.ID, time.Now())
+	if ld == nil {
+		return false
+	}
+	fh.state.SetJoined(int(u.ID), time.Now())
+	fh.SetUserRestriction(chat, u, false)
+	fh.raid.save()
+	if started {
+		fh.startLockdown(chat)
+	}
+	return true
+}
+
+// startLockdown alerts admins and optionally switches the chat to join requests
+func (fh *FeatureHandler) startLockdown(chat *tb.Chat) {
+	details := ""
+	if fh.raid.joinRequests {
+		// Exporting a new primary link revokes the old one that is being used for the raid
+		if _, err := fh.bot.InviteLink(chat); err != nil {
+			logrus.WithError(err).WithField("chat_id", chat.ID).Warn("Failed to revoke primary invite link")
+		}
+		link, err := fh.bot.CreateInviteLink(chat, &tb.ChatInviteLink{Name: "lockdown", JoinRequest: true})
+		if err != nil {
+			logrus.WithError(err).WithField("chat_id", chat.ID).Warn("Failed to create join request link")
+		} else {
+			fh.raid.update(chat.ID, func(ld *Lockdown) { ld.InviteLink = link.InviteLink })
+			details = "\nОсновная ссылка отозвана, вход по заявкам: " + link.InviteLink
+		}
+	}
+
+	btn := LockdownEndButton()
+	btn.Data = strconv.FormatInt(chat.ID, 10)
+	logMsg := fmt.Sprintf("🚨 Рейд: массовый вход в чат, включён режим блокировки.\n\nЧат: %s\nВходов: %d за %s\nПриветствия отключены, новые участники остаются с ограничениями до снятия блокировки.%s",
+		chat.Title, fh.raid.threshold, fh.raid.window, details)
+	alert, err := fh.bot.Send(&tb.Chat{ID: fh.adminChatID}, logMsg, &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{btn}}})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to send lockdown alert")
+	} else {
+		fh.raid.update(chat.ID, func(ld *Lockdown) { ld.AlertID = alert.ID })
+	}
+	fh.adminHandler.Audit(core.AuditLockdownStart, nil, nil, chat.ID, "raid", "")
+	logrus.WithField("chat_id", chat.ID).Warn("Raid lockdown started")
+}
+
+// endLockdown lifts a lockdown, admin is nil when it ends after the quiet period
+func (fh *FeatureHandler) endLockdown(chatID int64, admin *tb.User) bool {
+	ld, ok := fh.raid.end(chatID)
+	if !ok {
+		return false
+	}
+	chat := &tb.Chat{ID: chatID}
+	if ld.InviteLink != "" {
+		if _, err := fh.bot.RevokeInviteLink(chat, ld.InviteLink); err != nil {
+			logrus.WithError(err).WithField("chat_id", chatID).Warn("Failed to revoke lockdown invite link")
+		}
+	}
+	if ld.AlertID != 0 {
+		alert := tb.StoredMessage{MessageID: strconv.Itoa(ld.AlertID), ChatID: fh.adminChatID}
+		_, _ = fh.bot.EditReplyMarkup(alert, nil)
+	}
+
+	by := "тишина " + fh.raid.quiet.String()
+	if admin != nil {
+		by = fh.adminHandler.GetUserDisplayName(admin)
+	}
+	logMsg := fmt.Sprintf("✅ Режим блокировки снят.\n\nЧат: %s\nДлительность: %s\nВошло во время блокировки: %d (получат приветствие и проверку)\nСнял: %s",
+		ld.Title, time.Since(ld.Since).Round(time.Second), ld.Joined, by)
+	fh.adminHandler.LogToAdmin(logMsg)
+	fh.adminHandler.Audit(core.AuditLockdownEnd, admin, nil, chatID, "raid", fmt.Sprintf("joined %d", ld.Joined))
+	logrus.WithFields(logrus.Fields{"chat_id": chatID, "joined": ld.Joined}).Info("Raid lockdown ended")
+	go fh.welcomeLockdownJoiners(ld)
+	return true
+}
+
+// welcomeLockdownJoiners sends the welcome and verification to users who joined during a lockdown and are still restricted
+func (fh *FeatureHandler) welcomeLockdownJoiners(ld Lockdown) {
+	chat, err := fh.bot.ChatByID(ld.ChatID)
+	if err != nil {
+		chat = &tb.Chat{ID: ld.ChatID, Title: ld.Title}
+	}
+	welcomed := make(map[int64]bool)
+	for _, id := range ld.Joiners {
+		if welcomed[id] {
+			continue
+		}
+		welcomed[id] = true
+		// Users who left, were banned or let in by an admin meanwhile need no verification
+		member, err := fh.bot.ChatMemberOf(chat, &tb.User{ID: id})
+		if err != nil || member.User == nil || member.Role != tb.Restricted {
+			continue
+		}
+		u := member.User
+		verdict := fh.screenJoin(chat, u)
+		if verdict.Action == core.ScreenBan || verdict.Action == core.ScreenRestrict {
+			continue
+		}
+		fh.sendWelcome(chat, u)
+		logMsg := fmt.Sprintf("👤 Участник, вошедший во время блокировки, получил приветствие.\n\nПользователь: %s\nЧат: %s", fh.adminHandler.GetUserDisplayName(u), chat.Title)
+		if verdict.Action == core.ScreenFlag {
+			logMsg += fmt.Sprintf("\n\n⚠️ Подозрительный профиль (очки: %d):\n%s", verdict.Score, strings.Join(verdict.Signals, "\n"))
+		}
+		fh.logWithActions(logMsg, u, chat.ID, "", LogActionBan, LogActionUnrestrict)
+		time.Sleep(lockdownWelcomeInterval)
+	}
+}
+
+// runLockdownExpiry ends lockdowns after the quiet period
+func (fh *FeatureHandler) runLockdownExpiry() {
+	ticker := time.NewTicker(lockdownCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, chatID := range fh.raid.quietChats(time.Now()) {
+			fh.endLockdown(chatID, nil)
+		}
+	}
+}
+
+// HandleLockdownEnd ends a lockdown from the admin chat alert
+func (fh *FeatureHandler) HandleLockdownEnd(c tb.Context) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	cb := c.Callback()
+	if cb == nil || c.Sender() == nil {
+		return nil
+	}
+	if !fh.adminHandler.IsAdmin(&tb.Chat{ID: fh.adminChatID}, c.Sender()) {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Buttons.NotYourButton})
+		return nil
+	}
+	chatID, err := strconv.ParseInt(cb.Data, 10, 64)
+	if err != nil || !fh.endLockdown(chatID, c.Sender()) {
+		_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.LogActions.Expired})
+		_, _ = fh.bot.EditReplyMarkup(c.Message(), nil)
+		return nil
+	}
+	_ = fh.bot.Respond(cb)
+	return nil
+}
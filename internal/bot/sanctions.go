@@ -0,0 +1,306 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+const (
+	sanctionBan  = "ban"
+	sanctionMute = "mute"
+
+	defaultMuteDuration   = time.Hour
+	sanctionCheckInterval = 30 * time.Second
+)
+
+// Sanction is a temporary ban or mute waiting for expiry, ChatID 0 means all groups
+//
+// Held marks a mute applied without an end, which the bot must lift itself.
+type Sanction struct {
+	UserID int64     `json:"user_id"`
+	User   string    `json:"user"`
+	ChatID int64     `json:"chat_id"`
+	Kind   string    `json:"kind"`
+	Until  time.Time `json:"until"`
+	Held   bool      `json:"held,omitempty"`
+}
+
+// parseDuration parses durations like 30m, 12h, 7d or 2w
+func parseDuration(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	units := map[byte]time.Duration{'m': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	unit, ok := units[s[len(s)-1]]
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if !ok || err != nil || n <= 0 || n > math.MaxInt64/int64(unit) {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// durationArg returns the duration given after the target of a command, zero if there is none
+//
+// Any other trailing argument is an error, so a typo never turns into a permanent sanction.
+func durationArg(c tb.Context) (time.Duration, error) {
+	rest := strings.Fields(c.Message().Text)[1:]
+	// The first argument names the user, with a reply only a @username may be repeated there
+	if len(rest) > 0 && (c.Message().ReplyTo == nil || strings.HasPrefix(rest[0], "@")) {
+		rest = rest[1:]
+	}
+	switch len(rest) {
+	case 0:
+		return 0, nil
+	case 1:
+		return parseDuration(rest[0])
+	}
+	return 0, fmt.Errorf("unexpected arguments %q", strings.Join(rest, " "))
+}
+
+// scheduleSanction stores a sanction to be lifted at its expiry
+func (ah *AdminHandler) scheduleSanction(s Sanction) {
+	ah.cancelSanction(s.UserID, s.ChatID, s.Kind)
+	ah.sanctionsMu.Lock()
+	ah.sanctions = append(ah.sanctions, s)
+	ah.sanctionsMu.Unlock()
+	ah.saveSanctions()
+	if s.Kind == sanctionBan {
+		ah.bansMu.Lock()
+		if rec, ok := ah.bans[s.UserID]; ok {
+			rec.Until = s.Until
+			ah.bans[s.UserID] = rec
+		}
+		ah.bansMu.Unlock()
+		ah.saveBans()
+	}
+}
+
+// cancelSanction removes scheduled sanctions of a kind for user in chat
+func (ah *AdminHandler) cancelSanction(userID, chatID int64, kind string) {
+	ah.sanctionsMu.Lock()
+	kept := ah.sanctions[:0]
+	changed := false
+	for _, s := range ah.sanctions {
+		if s.UserID == userID && s.ChatID == chatID && s.Kind == kind {
+			changed = true
+			continue
+		}
+		kept = append(kept, s)
+	}
+	ah.sanctions = kept
+	ah.sanctionsMu.Unlock()
+	if changed {
+		ah.saveSanctions()
+	}
+}
+
+// runSanctionExpiry periodically lifts expired sanctions
+func (ah *AdminHandler) runSanctionExpiry() {
+	ticker := time.NewTicker(sanctionCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ah.expireSanctions(time.Now())
+	}
+}
+
+// expireSanctions lifts sanctions that expired before now
+func (ah *AdminHandler) expireSanctions(now time.Time) {
+	ah.sanctionsMu.Lock()
+	var expired []Sanction
+	kept := ah.sanctions[:0]
+	for _, s := range ah.sanctions {
+		if now.Before(s.Until) {
+			kept = append(kept, s)
+		} else {
+			expired = append(expired, s)
+		}
+	}
+	ah.sanctions = kept
+	ah.sanctionsMu.Unlock()
+	if len(expired) == 0 {
+		return
+	}
+	ah.saveSanctions()
+
+	for _, s := range expired {
+		user := &tb.User{ID: s.UserID}
+		switch s.Kind {
+		case sanctionBan:
+			rec, ok := ah.BanRecordOf(s.UserID)
+			if !ok || !rec.Until.Equal(s.Until) {
+				// The ban was lifted or replaced by a permanent one meanwhile
+				continue
+			}
+			// Telegram lifts its own ban, but groups registered later got a permanent one on join
+			ah.LiftGlobalBan(user)
+			ah.Audit(core.AuditBanExpired, nil, user, s.ChatID, "", "")
+			ah.LogToAdmin(fmt.Sprintf("⏰ Срок бана истёк.\n\nПользователь: %s", s.User))
+		case sanctionMute:
+			if s.Held || ah.state.IsNewbie(int(s.UserID)) {
+				_, chatIDs := ah.muteScope(s.ChatID)
+				for _, chatID := range chatIDs {
+					ah.restoreAfterMute(chatID, user)
+				}
+			}
+			ah.Audit(core.AuditMuteExpired, nil, user, s.ChatID, "", "")
+			ah.LogToAdmin(fmt.Sprintf("⏰ Срок мута истёк.\n\nПользователь: %s\nЧат: %d", s.User, s.ChatID))
+		}
+		logrus.WithFields(logrus.Fields{"user_id": s.UserID, "chat_id": s.ChatID, "kind": s.Kind}).Info("Sanction expired")
+	}
+}
+
+// MutedIn reports whether a pending mute covers user in chat
+func (ah *AdminHandler) MutedIn(userID, chatID int64) bool {
+	ah.sanctionsMu.Lock()
+	defer ah.sanctionsMu.Unlock()
+	for _, s := range ah.sanctions {
+		if s.UserID == userID && s.Kind == sanctionMute && (s.ChatID == chatID || s.ChatID == 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// muteTargets returns chats to mute in, the admin chat stands for all groups
+func (ah *AdminHandler) muteTargets(chat *tb.Chat) (int64, []int64) {
+	if chat.ID == ah.adminChatID {
+		return ah.muteScope(0)
+	}
+	return ah.muteScope(chat.ID)
+}
+
+// muteScope returns the chats a mute scope covers, 0 means all groups
+func (ah *AdminHandler) muteScope(scope int64) (int64, []int64) {
+	if scope == 0 {
+		return 0, ah.AllGroupIDs()
+	}
+	return scope, []int64{scope}
+}
+
+// restoreAfterMute gives back send rights after a mute, a newcomer who hasn't verified yet stays restricted
+func (ah *AdminHandler) restoreAfterMute(chatID int64, user *tb.User) {
+	rights := tb.Rights{CanSendMessages: true, CanSendPhotos: true, CanSendVideos: true, CanSendVideoNotes: true, CanSendVoiceNotes: true, CanSendPolls: true, CanSendOther: true, CanAddPreviews: true, CanInviteUsers: true}
+	if ah.state.IsNewbie(int(user.ID)) {
+		rights = tb.Rights{CanSendMessages: false}
+	}
+	if err := ah.bot.Restrict(&tb.Chat{ID: chatID}, &tb.ChatMember{User: user, Rights: rights, RestrictedUntil: tb.Forever()}); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": chatID, "user_id": user.ID}).Error("Failed to unmute user")
+	}
+}
+
+// MuteUser mutes a user for a duration and schedules the unmute, in the admin chat it mutes in all groups
+//
+// Telegram lifts the restriction by itself when it expires, except for newcomers who must stay restricted until they verify.
+func (ah *AdminHandler) MuteUser(chat *tb.Chat, user *tb.User, d time.Duration) time.Time {
+	until := time.Now().Add(d)
+	restrictedUntil := until.Unix()
+	held := ah.state.IsNewbie(int(user.ID))
+	if held {
+		restrictedUntil = tb.Forever()
+	}
+	scope, chatIDs := ah.muteTargets(chat)
+	for _, chatID := range chatIDs {
+		member := &tb.ChatMember{User: user, Rights: tb.Rights{CanSendMessages: false}, RestrictedUntil: restrictedUntil}
+		if err := ah.bot.Restrict(&tb.Chat{ID: chatID}, member); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"chat_id": chatID, "user_id": user.ID}).Error("Failed to mute user")
+		}
+	}
+	ah.scheduleSanction(Sanction{UserID: user.ID, User: ah.GetUserDisplayName(user), ChatID: scope, Kind: sanctionMute, Until: until, Held: held})
+	return until
+}
+
+// HandleMute mutes a user for a duration: /mute @user 1h
+func (ah *AdminHandler) HandleMute(c tb.Context) error {
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if c.Message() == nil || c.Sender() == nil || c.Chat().Type == tb.ChatPrivate || !ah.IsAdmin(c.Chat(), c.Sender()) {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.MuteCommandAdminOnly)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+	d, err := durationArg(c)
+	if d == 0 {
+		d = defaultMuteDuration
+	}
+	target := ah.resolveTargetUserOrID(c)
+	if target == nil || err != nil {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.MuteUsage)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+	if ah.IsAdmin(c.Chat(), target) {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.MuteCannotMuteAdmin)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+
+	until := ah.MuteUser(c.Chat(), target, d)
+	untilStr := until.Format("2006-01-02 15:04")
+	ah.Audit(core.AuditMute, c.Sender(), target, c.Chat().ID, "mute", "until "+untilStr)
+	_, _ = ah.bot.Send(c.Chat(), fmt.Sprintf(msgs.Admin.MuteSuccess, ah.GetUserDisplayName(target), untilStr))
+	ah.LogToAdmin(fmt.Sprintf("🔇 Пользователь замучен.\n\nПользователь: %s\nДо: %s\nАдмин: %s", ah.GetUserDisplayName(target), untilStr, ah.GetUserDisplayName(c.Sender())))
+	return nil
+}
+
+// HandleUnmute lifts a mute before its expiry
+func (ah *AdminHandler) HandleUnmute(c tb.Context) error {
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if c.Message() == nil || c.Sender() == nil || c.Chat().Type == tb.ChatPrivate || !ah.IsAdmin(c.Chat(), c.Sender()) {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.MuteCommandAdminOnly)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+	target := ah.resolveTargetUserOrID(c)
+	if target == nil {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.MuteUsage)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+
+	scope, chatIDs := ah.muteTargets(c.Chat())
+	for _, chatID := range chatIDs {
+		ah.restoreAfterMute(chatID, target)
+	}
+	ah.cancelSanction(target.ID, scope, sanctionMute)
+
+	ah.Audit(core.AuditUnmute, c.Sender(), target, c.Chat().ID, "", "")
+	_, _ = ah.bot.Send(c.Chat(), fmt.Sprintf(msgs.Admin.UnmuteSuccess, ah.GetUserDisplayName(target)))
+	ah.LogToAdmin(fmt.Sprintf("🔊 Мут снят.\n\nПользователь: %s\nАдмин: %s", ah.GetUserDisplayName(target), ah.GetUserDisplayName(c.Sender())))
+	return nil
+}
+
+// saveSanctions persists scheduled sanctions to disk
+func (ah *AdminHandler) saveSanctions() {
+	ah.sanctionsMu.Lock()
+	data, err := json.MarshalIndent(ah.sanctions, "", "  ")
+	ah.sanctionsMu.Unlock()
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(ah.sanctionsFile, data, 0644)
+}
+
+// loadSanctions reads scheduled sanctions from disk
+func (ah *AdminHandler) loadSanctions() {
+	data, err := os.ReadFile(ah.sanctionsFile)
+	if err != nil {
+		return
+	}
+	ah.sanctionsMu.Lock()
+	_ = json.Unmarshal(data, &ah.sanctions)
+	ah.sanctionsMu.Unlock()
+}
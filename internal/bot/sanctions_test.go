@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	tb "gopkg.in/telebot.v4"
+)
+
+func TestParseDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"30m": 30 * time.Minute,
+		"12h": 12 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	}
+	for s, want := range valid {
+		if d, err := parseDuration(s); err != nil || d != want {
+			t.Errorf("parseDuration(%q) = %v, %v", s, d, err)
+		}
+	}
+	for _, s := range []string{"", "d", "7x", "1.5h", "0d", "-1h", "h1", "99999999999w", "9223372036854775807m"} {
+		if d, err := parseDuration(s); err == nil {
+			t.Errorf("parseDuration(%q) = %v, want an error", s, d)
+		}
+	}
+}
+
+func TestDurationArg(t *testing.T) {
+	command := func(text string, reply bool) tb.Context {
+		msg := &tb.Message{Text: text}
+		if reply {
+			msg.ReplyTo = &tb.Message{}
+		}
+		return tb.NewContext(nil, tb.Update{Message: msg})
+	}
+	tests := []struct {
+		text  string
+		reply bool
+		want  time.Duration
+		ok    bool
+	}{
+		{"/spamban @x", false, 0, true},
+		{"/spamban 123", false, 0, true},
+		{"/spamban @x 7d", false, 7 * 24 * time.Hour, true},
+		{"/spamban @x 7x", false, 0, false},
+		{"/spamban @x 1.5h", false, 0, false},
+		{"/spamban @x 0d", false, 0, false},
+		{"/spamban @x 7d spam", false, 0, false},
+		{"/spamban", true, 0, true},
+		{"/spamban 12h", true, 12 * time.Hour, true},
+		{"/spamban @x", true, 0, true},
+		{"/spamban @x 12h", true, 12 * time.Hour, true},
+		{"/spamban 7", true, 0, false},
+	}
+	for _, tt := range tests {
+		d, err := durationArg(command(tt.text, tt.reply))
+		if d != tt.want || (err == nil) != tt.ok {
+			t.Errorf("durationArg(%q, reply %v) = %v, %v", tt.text, tt.reply, d, err)
+		}
+	}
+}
+
+func TestMutedIn(t *testing.T) {
+	ah := &AdminHandler{sanctions: []Sanction{
+		{UserID: 1, ChatID: -100, Kind: sanctionMute},
+		{UserID: 2, ChatID: 0, Kind: sanctionMute},
+		{UserID: 3, ChatID: -100, Kind: sanctionBan},
+	}}
+	tests := []struct {
+		user, chat int64
+		want       bool
+	}{
+		{1, -100, true},
+		{1, -200, false},
+		{2, -200, true},
+		{3, -100, false},
+		{4, -100, false},
+	}
+	for _, tt := range tests {
+		if got := ah.MutedIn(tt.user, tt.chat); got != tt.want {
+			t.Errorf("MutedIn(%d, %d) = %v", tt.user, tt.chat, got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"UEPB/internal/core"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+// suspiciousNameEmojis are emojis typical for crypto and adult spam accounts
+var suspiciousNameEmojis = []string{"💰", "💸", "🤑", "💵", "💎", "🚀", "📈", "🪙", "₿", "🔞", "🍑", "🍆", "💋", "👙"}
+
+// inviteLinkMarkers identify Telegram invite links in a bio
+var inviteLinkMarkers = []string{"t.me/", "telegram.me/", "telegram.dog/", "joinchat", "tg://join"}
+
+// ProfileScreener scores names, bios and account signals of joining users
+type ProfileScreener struct {
+	bot           *tb.Bot
+	blacklist     core.BlacklistInterface
+	hidden        *hiddenDetector
+	enabled       bool
+	recentID      int64
+	flagScore     int
+	restrictScore int
+	banScore      int
+}
+
+// NewProfileScreener creates the default join screener with thresholds from the environment
+func NewProfileScreener(bot *tb.Bot, blacklist core.BlacklistInterface) core.JoinScreener {
+	return &ProfileScreener{
+		bot:           bot,
+		blacklist:     blacklist,
+		hidden:        newHiddenDetector(),
+		enabled:       envBool("SCREEN_ENABLED", true),
+		recentID:      int64(envInt("SCREEN_RECENT_ID", 8000000000)),
+		flagScore:     envInt("SCREEN_FLAG_SCORE", 2),
+		restrictScore: envInt("SCREEN_RESTRICT_SCORE", 4),
+		banScore:      envInt("SCREEN_BAN_SCORE", 6),
+	}
+}
+
+// Screen scores a joining user and picks an action
+func (ps *ProfileScreener) Screen(user *tb.User) core.ScreenVerdict {
+	v := core.ScreenVerdict{Action: core.ScreenAllow}
+	if !ps.enabled || user == nil || user.IsBot {
+		return v
+	}
+	add := func(score int, signal string) {
+		v.Score += score
+		v.Signals = append(v.Signals, fmt.Sprintf("%s (+%d)", signal, score))
+	}
+
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if ps.blacklist != nil {
+		if phrase, ok := ps.blacklist.Match(name); ok {
+			add(3, "фраза из чёрного списка в имени: "+strings.Join(phrase, " "))
+		}
+	}
+	if signals := ps.hidden.signals(name); len(signals) > 0 {
+		add(2, "скрытые символы в имени: "+strings.Join(signals, ", "))
+	}
+	for _, r := range suspiciousNameEmojis {
+		if strings.Contains(name, r) {
+			add(2, "подозрительные эмодзи в имени")
+			break
+		}
+	}
+
+	if chat, err := ps.bot.ChatByID(user.ID); err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Debug("Failed to get user bio for screening")
+	} else if bio := strings.ToLower(chat.Bio); bio != "" {
+		for _, m := range inviteLinkMarkers {
+			if strings.Contains(bio, m) {
+				add(3, "ссылка-приглашение в описании")
+				break
+			}
+		}
+		if ps.blacklist != nil {
+			if phrase, ok := ps.blacklist.Match(bio); ok {
+				add(2, "фраза из чёрного списка в описании: "+strings.Join(phrase, " "))
+			}
+		}
+	}
+
+	if user.Username == "" {
+		add(1, "нет юзернейма")
+	}
+	if ps.recentID > 0 && user.ID >= ps.recentID {
+		add(1, "недавно созданный аккаунт")
+	}
+
+	switch {
+	case ps.banScore > 0 && v.Score >= ps.banScore:
+		v.Action = core.ScreenBan
+	case ps.restrictScore > 0 && v.Score >= ps.restrictScore:
+		v.Action = core.ScreenRestrict
+	case ps.flagScore > 0 && v.Score >= ps.flagScore:
+		v.Action = core.ScreenFlag
+	}
+	return v
+}
@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"UEPB/internal/core"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Settings stores per-chat settings backed by a JSON file in data/
+type Settings struct {
+	mu       sync.RWMutex
+	Chats    map[int64]core.ChatSettings `json:"chats"`
+	defaults core.ChatSettings
+	file     string
+}
+
+// NewSettings creates per-chat settings with defaults taken from the environment
+func NewSettings(file string) core.ChatSettingsInterface {
+	dataDir := "data"
+	_ = os.MkdirAll(dataDir, 0755)
+	if !strings.HasPrefix(file, "data/") {
+		file = "data/" + file
+	}
+	s := &Settings{Chats: make(map[int64]core.ChatSettings), defaults: defaultChatSettings(), file: file}
+	s.load()
+	return s
+}
+
+// defaultChatSettings returns settings used for chats without overrides
+func defaultChatSettings() core.ChatSettings {
+	return core.ChatSettings{
+		Flood: core.FloodSettings{
+			Disabled:     !envBool("FLOOD_ENABLED", true),
+			MaxMessages:  envInt("FLOOD_MAX_MESSAGES", 8),
+			WindowSec:    envInt("FLOOD_WINDOW_SEC", 10),
+			MaxIdentical: envInt("FLOOD_MAX_IDENTICAL", 3),
+			MaxLines:     envInt("FLOOD_MAX_LINES", 20),
+			MuteMinutes:  max(envInt("FLOOD_MUTE_MINUTES", 30), 1),
+		},
+	}
+}
+
+// Get returns a copy of the settings of a chat, slices included so callers may read them without the lock
+func (s *Settings) Get(chatID int64) core.ChatSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cs, ok := s.Chats[chatID]
+	if !ok {
+		cs = s.defaults
+	}
+	cs.Locks = slices.Clone(cs.Locks)
+	return cs
+}
+
+// Update changes settings of a chat and persists them, fn gets its own copy of the slices
+func (s *Settings) Update(chatID int64, fn func(cs *core.ChatSettings)) {
+	s.mu.Lock()
+	cs, ok := s.Chats[chatID]
+	if !ok {
+		cs = s.defaults
+	}
+	cs.Locks = slices.Clone(cs.Locks)
+	fn(&cs)
+	s.Chats[chatID] = cs
+	s.mu.Unlock()
+	s.save()
+}
+
+// Migrate moves settings of a chat to its new ID
+func (s *Settings) Migrate(from, to int64) {
+	s.mu.Lock()
+	cs, ok := s.Chats[from]
+	if ok {
+		s.Chats[to] = cs
+		delete(s.Chats, from)
+	}
+	s.mu.Unlock()
+	if ok {
+		s.save()
+	}
+}
+
+// save persists settings to disk
+func (s *Settings) save() {
+	s.mu.RLock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		logrus.WithError(err).Error("settings marshal")
+		return
+	}
+	_ = os.WriteFile(s.file, data, 0644)
+}
+
+// load reads settings from disk
+func (s *Settings) load() {
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return
+	}
+	// Decode every chat on top of defaults so that newly added settings get sane values
+	var raw struct {
+		Chats map[int64]json.RawMessage `json:"chats"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		logrus.WithError(err).Error("settings unmarshal")
+		return
+	}
+	for id, r := range raw.Chats {
+		cs := s.defaults
+		if err := json.Unmarshal(r, &cs); err == nil {
+			s.Chats[id] = cs
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+
+	"UEPB/internal/core"
+)
+
+func TestSettingsGetCopiesLocks(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewSettings("chat_settings.json")
+	s.Update(1, func(cs *core.ChatSettings) { cs.Locks = []string{LockLink, LockPoll, LockSticker} })
+
+	locks := s.Get(1).Locks
+	s.Update(1, func(cs *core.ChatSettings) {
+		cs.Locks = slices.DeleteFunc(cs.Locks, func(t string) bool { return t == LockLink })
+	})
+	if !slices.Equal(locks, []string{LockLink, LockPoll, LockSticker}) {
+		t.Errorf("locks read before the update changed: %v", locks)
+	}
+	if got := s.Get(1).Locks; !slices.Equal(got, []string{LockPoll, LockSticker}) {
+		t.Errorf("locks after the update: %v", got)
+	}
+}
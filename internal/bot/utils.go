@@ -4,6 +4,7 @@ import (
 	"UEPB/internal/core"
 	"UEPB/internal/i18n"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,11 +27,28 @@ type FeatureHandler struct {
 	adminHandler    core.AdminHandlerInterface
 	userLanguages   map[int64]i18n.Lang
 	userLanguagesMu sync.RWMutex
+	logExcerpts     logExcerpts
+	settings        core.ChatSettingsInterface
+	flood           *floodDetector
+	dups            *dupDetector
+	premod          *premodQueue
+	raid            *raidGuard
+	verify          *verifyDeadlines
+	lockViolation   bool
+	hidden          *hiddenDetector
+	email           *emailVerifier
+	captchas        *captchaStore
+	screener        core.JoinScreener
+	banList         core.BanListProvider
+	classifier      core.SpamClassifierInterface
+	bayesFlag       float64
+	bayesDelete     float64
+	bayesHamAge     time.Duration
 }
 
 // NewFeatureHandler constructs feature handler
-func NewFeatureHandler(bot *tb.Bot, state core.UserState, quiz core.QuizInterface, blacklist core.BlacklistInterface, adminChatID int64, violations map[int64]int, adminHandler core.AdminHandlerInterface, btns struct{ Student, Guest, Ads tb.InlineButton }) *FeatureHandler {
-	return &FeatureHandler{
+func NewFeatureHandler(bot *tb.Bot, state core.UserState, quiz core.QuizInterface, blacklist core.BlacklistInterface, adminChatID int64, violations map[int64]int, adminHandler core.AdminHandlerInterface, settings core.ChatSettingsInterface, screener core.JoinScreener, banList core.BanListProvider, classifier core.SpamClassifierInterface, mailer core.Mailer, btns struct{ Student, Guest, Ads tb.InlineButton }) *FeatureHandler {
+	fh := &FeatureHandler{
 		bot:           bot,
 		state:         state,
 		quiz:          quiz,
@@ -41,7 +59,38 @@ func NewFeatureHandler(bot *tb.Bot, state core.UserState, quiz core.QuizInterfac
 		Btns:          btns,
 		adminHandler:  adminHandler,
 		userLanguages: make(map[int64]i18n.Lang),
+		settings:      settings,
+		flood:         newFloodDetector(),
+		dups:          newDupDetector(),
+		premod:        newPremodQueue("premod.json"),
+		screener:      screener,
+		banList:       banList,
+		classifier:    classifier,
+		bayesFlag:     envFloat("BAYES_FLAG_SCORE", 0.8),
+		bayesDelete:   envFloat("BAYES_DELETE_SCORE", 0.97),
+		bayesHamAge:   envDuration("BAYES_HAM_AGE", 30*24*time.Hour),
+		raid:          newRaidGuard("lockdowns.json"),
+		verify:        newVerifyDeadlines("verification.json"),
+		lockViolation: envBool("LOCK_COUNTS_VIOLATION", true),
+		hidden:        newHiddenDetector(),
+		captchas:      newCaptchaStore(),
 	}
+	if mailer != nil {
+		fh.email = newEmailVerifier("email_verify.json", mailer)
+	}
+	go fh.runLockdownExpiry()
+	go fh.runVerifyExpiry()
+	return fh
+}
+
+// MigrateChat moves per-chat settings and state to the new chat ID after a group upgrade
+func (fh *FeatureHandler) MigrateChat(from, to int64) {
+	if fh.settings != nil {
+		fh.settings.Migrate(from, to)
+	}
+	fh.flood.migrate(from, to)
+	fh.raid.migrate(from, to)
+	fh.verify.migrate(from, to)
 }
 
 // getLangForUser returns language for a specific user based on their Telegram language
@@ -88,14 +137,33 @@ func (fh *FeatureHandler) getLangForUser(user *tb.User) i18n.Lang {
 	return getLangForUser(user, fh.userLanguages, &fh.userLanguagesMu)
 }
 
-// OnlyNewbies restricts handler to newbies
+// ownerData binds callback data to the user a keyboard is shown to
+func ownerData(userID int64, data string) string {
+	if data == "" {
+		return strconv.FormatInt(userID, 10)
+	}
+	return strconv.FormatInt(userID, 10) + "|" + data
+}
+
+// ownButton checks that a button was shown to the user and strips the owner from its data
+func ownButton(cb *tb.Callback, u *tb.User) bool {
+	owner, rest, _ := strings.Cut(cb.Data, "|")
+	if owner != strconv.FormatInt(u.ID, 10) {
+		return false
+	}
+	cb.Data = rest
+	return true
+}
+
+// OnlyNewbies restricts handler to the newbie the keyboard was shown to
 func (fh *FeatureHandler) OnlyNewbies(handler func(tb.Context) error) func(tb.Context) error {
 	return func(c tb.Context) error {
 		lang := fh.getLangForUser(c.Sender())
 		msgs := i18n.Get().T(lang)
 
-		if c.Sender() == nil || !fh.state.IsNewbie(int(c.Sender().ID)) {
-			if cb := c.Callback(); cb != nil {
+		cb := c.Callback()
+		if c.Sender() == nil || !fh.state.IsNewbie(int(c.Sender().ID)) || (cb != nil && !ownButton(cb, c.Sender())) {
+			if cb != nil {
 				_ = fh.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Buttons.NotYourButton})
 			}
 			return nil
@@ -155,29 +223,116 @@ func (fh *FeatureHandler) HandleUserJoined(c tb.Context) error {
 	}
 	users := GetNewUsers(c.Message())
 	for _, u := range users {
-		lang := fh.getLangForUser(u)
-		msgs := i18n.Get().T(lang)
-
-		studentBtn := tb.InlineButton{Unique: "student", Text: msgs.Buttons.Student}
-		guestBtn := tb.InlineButton{Unique: "guest", Text: msgs.Buttons.Guest}
-		adsBtn := tb.InlineButton{Unique: "ads", Text: msgs.Buttons.Ads}
-		kb := &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{studentBtn}, {guestBtn}, {adsBtn}}}
-
-		fh.state.SetNewbie(int(u.ID))
-		fh.SetUserRestriction(c.Chat(), u, false)
-		txt := msgs.Welcome.Greeting + "\n\n" + msgs.Welcome.ChooseOption
-		if u.Username != "" {
-			txt = fmt.Sprintf(msgs.Welcome.GreetingWithUsername, u.Username) + "\n\n" + msgs.Welcome.ChooseOption
+		if !fh.raid.firstJoin(c.Chat().ID, c.Message().ID, u.ID, time.Now()) {
+			continue
 		}
-		msg := fh.SendOrEdit(c.Chat(), nil, txt, kb)
-		fh.adminHandler.DeleteAfter(msg, 5*time.Minute)
-		fh.state.InitUser(int(u.ID))
+		if fh.adminHandler.IsGloballyBanned(u.ID) {
+			if err := fh.adminHandler.BanUser(c.Chat(), u); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"chat_id": c.Chat().ID, "user_id": u.ID}).Error("Failed to enforce global ban")
+				continue
+			}
+			logMsg := fmt.Sprintf("⛔ Пользователь из глобального бан-листа зашёл в чат и был забанен.\n\nПользователь: %s\nЧат: %s", fh.adminHandler.GetUserDisplayName(u), c.Chat().Title)
+			fh.adminHandler.LogToAdmin(logMsg)
+			fh.adminHandler.Audit(core.AuditGlobalBanJoin, nil, u, c.Chat().ID, "global ban list", "")
+			continue
+		}
+		if fh.checkBanList(c.Chat(), u) {
+			continue
+		}
+		if fh.lockdownJoin(c.Chat(), u) {
+			continue
+		}
+		fh.state.SetJoined(int(u.ID), time.Now())
+		verdict := fh.screenJoin(c.Chat(), u)
+		if verdict.Action == core.ScreenBan || verdict.Action == core.ScreenRestrict {
+			continue
+		}
+		fh.SetUserRestriction(c.Chat(), u, false)
+		fh.sendWelcome(c.Chat(), u)
 		logMsg := fmt.Sprintf("👤 Новый участник вошёл в чат.\n\nПользователь: %s", fh.adminHandler.GetUserDisplayName(u))
-		fh.adminHandler.LogToAdmin(logMsg)
+		if verdict.Action == core.ScreenFlag {
+			logMsg += fmt.Sprintf("\n\n⚠️ Подозрительный профиль (очки: %d):\n%s", verdict.Score, strings.Join(verdict.Signals, "\n"))
+		}
+		fh.logWithActions(logMsg, u, c.Chat().ID, "", LogActionBan, LogActionUnrestrict)
 	}
 	return nil
 }
 
+// screenJoin runs the join screener and bans or silently restricts suspicious users
+func (fh *FeatureHandler) screenJoin(chat *tb.Chat, u *tb.User) core.ScreenVerdict {
+	if fh.screener == nil {
+		return core.ScreenVerdict{Action: core.ScreenAllow}
+	}
+	verdict := fh.screener.Screen(u)
+	signals := strings.Join(verdict.Signals, "\n")
+	switch verdict.Action {
+	case core.ScreenBan:
+		if err := fh.adminHandler.BanUser(chat, u); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"chat_id": chat.ID, "user_id": u.ID}).Error("Failed to ban screened user")
+			return verdict
+		}
+		fh.adminHandler.RecordBan(u, chat.ID, "join screening", signals, nil)
+		fh.adminHandler.Audit(core.AuditScreenBan, nil, u, chat.ID, "join screening", signals)
+		logMsg := fmt.Sprintf("🛡 Пользователь забанен при входе по профилю.\n\nПользователь: %s\nЧат: %s\nОчки: %d\n%s", fh.adminHandler.GetUserDisplayName(u), chat.Title, verdict.Score, signals)
+		fh.adminHandler.LogToAdmin(logMsg)
+	case core.ScreenRestrict:
+		fh.SetUserRestriction(chat, u, false)
+		fh.adminHandler.Audit(core.AuditScreenRestrict, nil, u, chat.ID, "join screening", signals)
+		logMsg := fmt.Sprintf("🛡 Подозрительный профиль: пользователь оставлен с ограничениями без приветствия.\n\nПользователь: %s\nЧат: %s\nОчки: %d\n%s", fh.adminHandler.GetUserDisplayName(u), chat.Title, verdict.Score, signals)
+		fh.logWithActions(logMsg, u, chat.ID, "", LogActionUnrestrict, LogActionRequiz, LogActionBan)
+	case core.ScreenFlag:
+		fh.adminHandler.Audit(core.AuditScreenFlag, nil, u, chat.ID, "join screening", signals)
+	}
+	if verdict.Action != core.ScreenAllow {
+		logrus.WithFields(logrus.Fields{"chat_id": chat.ID, "user_id": u.ID, "score": verdict.Score, "action": verdict.Action}).Info("Join screening verdict")
+	}
+	return verdict
+}
+
+// welcomeKeyboard returns the verification options bound to the user, group is set when they are shown in a private chat
+func welcomeKeyboard(msgs *i18n.Messages, u *tb.User, group string) *tb.ReplyMarkup {
+	owner := ownerData(u.ID, group)
+	studentBtn := tb.InlineButton{Unique: "student", Text: msgs.Buttons.Student, Data: owner}
+	guestBtn := tb.InlineButton{Unique: "guest", Text: msgs.Buttons.Guest, Data: owner}
+	adsBtn := tb.InlineButton{Unique: "ads", Text: msgs.Buttons.Ads, Data: owner}
+	return &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{studentBtn}, {guestBtn}, {adsBtn}}}
+}
+
+// sendWelcome marks user as newbie and sends the welcome message with verification options
+func (fh *FeatureHandler) sendWelcome(chat *tb.Chat, u *tb.User) {
+	lang := fh.getLangForUser(u)
+	msgs := i18n.Get().T(lang)
+
+	policy := fh.quiz.Policy(chat.ID)
+	_, captcha := verifiers[policy.Method]
+	kb := welcomeKeyboard(msgs, u, "")
+	prompt := msgs.Welcome.ChooseOption
+	if policy.Private {
+		// The options are shown in the private chat the button leads to
+		link := fmt.Sprintf("https://t.me/%s?start=verify_%d", fh.bot.Me.Username, chat.ID)
+		kb = &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{{Text: msgs.Verify.Button, URL: link}}}}
+		prompt = msgs.Verify.PrivatePrompt
+	}
+
+	fh.state.SetNewbie(int(u.ID))
+	greeting := msgs.Welcome.Greeting
+	if u.Username != "" {
+		greeting = fmt.Sprintf(msgs.Welcome.GreetingWithUsername, u.Username)
+	}
+	var msg *tb.Message
+	if captcha && !policy.Private {
+		// A CAPTCHA replaces the options, the check is all such a chat needs
+		msg = fh.sendChallenge(chat, chat, u, policy.Method, greeting)
+	} else {
+		msg = fh.SendOrEdit(chat, nil, greeting+"\n\n"+prompt, kb)
+	}
+	// With a deadline the message stays until the user verifies or is kicked
+	if !fh.startVerification(chat, u, msg, 0) {
+		fh.adminHandler.DeleteAfter(msg, 5*time.Minute)
+	}
+	fh.state.InitUser(int(u.ID))
+}
+
 // HandleUserLeft clears the state on leave
 func (fh *FeatureHandler) HandleUserLeft(c tb.Context) error {
 	if c.Message() == nil || c.Chat() == nil || c.Message().UserLeft == nil {
@@ -185,6 +340,9 @@ func (fh *FeatureHandler) HandleUserLeft(c tb.Context) error {
 	}
 	user := c.Message().UserLeft
 	fh.state.ClearNewbie(int(user.ID))
+	fh.state.Reset(int(user.ID))
+	fh.verificationDone(c.Chat(), user)
+	fh.captchas.drop(c.Chat().ID, user.ID)
 	fh.adminHandler.ClearViolations(user.ID)
 	logMsg := fmt.Sprintf("👋 Участник покинул чат.\n\nПользователь: %s", fh.adminHandler.GetUserDisplayName(user))
 	fh.adminHandler.LogToAdmin(logMsg)
@@ -196,12 +354,19 @@ func (fh *FeatureHandler) HandleGuest(c tb.Context) error {
 	lang := fh.getLangForUser(c.Sender())
 	msgs := i18n.Get().T(lang)
 
-	fh.SetUserRestriction(c.Chat(), c.Sender(), true)
+	group := fh.verifyChat(c)
+	if group == nil {
+		return fh.verifyExpired(c)
+	}
+	fh.SetUserRestriction(group, c.Sender(), true)
 	fh.state.ClearNewbie(int(c.Sender().ID))
+	fh.verificationDone(group, c.Sender())
+	fh.startPremod(c.Sender())
 	msg := fh.SendOrEdit(c.Chat(), c.Message(), msgs.Guest.CanWrite, nil)
 	fh.adminHandler.DeleteAfter(msg, 5*time.Second)
 	logMsg := fmt.Sprintf("🧐 Пользователь выбрал, что у него есть вопрос.\n\nПользователь: %s", fh.adminHandler.GetUserDisplayName(c.Sender()))
 	fh.adminHandler.LogToAdmin(logMsg)
+	fh.adminHandler.Audit(core.AuditGuest, nil, c.Sender(), group.ID, "", "")
 	return nil
 }
 
@@ -226,13 +391,43 @@ func (fh *FeatureHandler) HandleStart(c tb.Context) error {
 		return nil
 	}
 	uid := c.Sender().ID
+	if payload, ok := strings.CutPrefix(c.Message().Payload, "verify_"); ok {
+		return fh.startPrivateVerification(c, payload)
+	}
 	_, err := fh.bot.Send(c.Chat(), msgs.Start.Greeting)
 	logrus.WithField("user_id", uid).Info("User started bot")
 	return err
 }
 
-// HandlePrivateMessage handles any non-command private message
+// startPrivateVerification shows the verification options in a private chat for a group the user is restricted in
+func (fh *FeatureHandler) startPrivateVerification(c tb.Context, payload string) error {
+	lang := fh.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	// Only a verification the group welcome started can be continued, a restriction from an admin is not one
+	groupID, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil || !fh.state.IsNewbie(int(c.Sender().ID)) || !fh.verify.has(groupID, c.Sender().ID) {
+		_, err := fh.bot.Send(c.Chat(), msgs.Verify.NotPending)
+		return err
+	}
+	member, err := fh.bot.ChatMemberOf(&tb.Chat{ID: groupID}, c.Sender())
+	if err != nil || member.Role == tb.Left || member.Role == tb.Kicked {
+		_, err := fh.bot.Send(c.Chat(), msgs.Verify.NotPending)
+		return err
+	}
+	if method := fh.quiz.Policy(groupID).Method; verifiers[method] != nil {
+		fh.sendChallenge(c.Chat(), &tb.Chat{ID: groupID, Type: tb.ChatSuperGroup}, c.Sender(), method, "")
+	} else {
+		_, err = fh.bot.Send(c.Chat(), msgs.Welcome.ChooseOption, welcomeKeyboard(msgs, c.Sender(), payload))
+	}
+	logrus.WithFields(logrus.Fields{"user_id": c.Sender().ID, "chat_id": groupID}).Info("Private verification started")
+	return err
+}
+
+// HandlePrivateMessage handles any non-command private message, only e-mail verification expects input there
 func (fh *FeatureHandler) HandlePrivateMessage(c tb.Context) error {
-	// No special handling needed for private messages
+	if c.Message() != nil && c.Message().Text != "" {
+		fh.handleEmailInput(c)
+	}
 	return nil
 }
@@ -0,0 +1,321 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+const verifyCheckInterval = 15 * time.Second
+
+// Verification is the deadline for a newcomer to pick a welcome option and pass verification
+//
+// Deadline is zero when VERIFY_TIMEOUT is off, the entry then only marks the verification as pending.
+type Verification struct {
+	ChatID     int64     `json:"chat_id"`
+	Title      string    `json:"title"`
+	User       *tb.User  `json:"user"`
+	Deadline   time.Time `json:"deadline"`
+	MessageID  int       `json:"message_id,omitempty"`
+	ReminderID int       `json:"reminder_id,omitempty"`
+	Reminded   bool      `json:"reminded"`
+}
+
+// verifyDeadlines keeps pending verifications backed by a JSON file in data/
+type verifyDeadlines struct {
+	mu      sync.Mutex
+	pending map[string]*Verification
+	file    string
+	timeout time.Duration
+	remind  time.Duration
+}
+
+// newVerifyDeadlines creates the deadline store configured from the environment
+func newVerifyDeadlines(file string) *verifyDeadlines {
+	_ = os.MkdirAll("data", 0755)
+	if !strings.HasPrefix(file, "data/") {
+		file = "data/" + file
+	}
+	vd := &verifyDeadlines{
+		pending: make(map[string]*Verification),
+		file:    file,
+		timeout: envDuration("VERIFY_TIMEOUT", 10*time.Minute),
+		remind:  envDuration("VERIFY_REMIND", 3*time.Minute),
+	}
+	vd.load()
+	return vd
+}
+
+// verifyKey identifies a verification of a user in a chat
+func verifyKey(chatID, userID int64) string {
+	return fmt.Sprintf("%d:%d", chatID, userID)
+}
+
+// start sets or replaces the deadline of a user in a chat
+func (vd *verifyDeadlines) start(v *Verification) {
+	vd.mu.Lock()
+	vd.pending[verifyKey(v.ChatID, v.User.ID)] = v
+	vd.mu.Unlock()
+	vd.save()
+}
+
+// setReminder remembers the reminder message so it can be removed later
+func (vd *verifyDeadlines) setReminder(chatID, userID int64, msgID int) {
+	vd.mu.Lock()
+	v, ok := vd.pending[verifyKey(chatID, userID)]
+	if ok {
+		v.ReminderID = msgID
+	}
+	vd.mu.Unlock()
+	if ok {
+		vd.save()
+	}
+}
+
+// setMessage points the deadline at a new welcome message without moving it
+func (vd *verifyDeadlines) setMessage(chatID, userID int64, msgID int) {
+	vd.mu.Lock()
+	v, ok := vd.pending[verifyKey(chatID, userID)]
+	if ok {
+		v.MessageID = msgID
+	}
+	vd.mu.Unlock()
+	if ok {
+		vd.save()
+	}
+}
+
+// has reports whether a user has a pending verification in a chat
+func (vd *verifyDeadlines) has(chatID, userID int64) bool {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+	_, ok := vd.pending[verifyKey(chatID, userID)]
+	return ok
+}
+
+// remove drops and returns the verification of a user in a chat
+func (vd *verifyDeadlines) remove(chatID, userID int64) (Verification, bool) {
+	vd.mu.Lock()
+	key := verifyKey(chatID, userID)
+	v, ok := vd.pending[key]
+	delete(vd.pending, key)
+	vd.mu.Unlock()
+	if !ok {
+		return Verification{}, false
+	}
+	vd.save()
+	return *v, true
+}
+
+// due returns verifications that need a reminder and those whose deadline has passed
+func (vd *verifyDeadlines) due(now time.Time) (remind, expired []Verification) {
+	vd.mu.Lock()
+	changed := false
+	for _, v := range vd.pending {
+		switch {
+		case v.Deadline.IsZero():
+		case !now.Before(v.Deadline):
+			expired = append(expired, *v)
+		case !v.Reminded && vd.remind > 0 && !now.Before(v.Deadline.Add(-vd.remind)):
+			v.Reminded = true
+			changed = true
+			remind = append(remind, *v)
+		}
+	}
+	vd.mu.Unlock()
+	if changed {
+		vd.save()
+	}
+	return remind, expired
+}
+
+// migrate moves verifications to the new chat ID
+func (vd *verifyDeadlines) migrate(from, to int64) {
+	vd.mu.Lock()
+	changed := false
+	for key, v := range vd.pending {
+		if v.ChatID == from {
+			delete(vd.pending, key)
+			v.ChatID = to
+			vd.pending[verifyKey(to, v.User.ID)] = v
+			changed = true
+		}
+	}
+	vd.mu.Unlock()
+	if changed {
+		vd.save()
+	}
+}
+
+// save persists pending verifications to disk
+func (vd *verifyDeadlines) save() {
+	vd.mu.Lock()
+	data, err := json.MarshalIndent(vd.pending, "", "  ")
+	vd.mu.Unlock()
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(vd.file, data, 0644)
+}
+
+// load reads pending verifications from disk
+func (vd *verifyDeadlines) load() {
+	data, err := os.ReadFile(vd.file)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, &vd.pending)
+	if vd.pending == nil {
+		vd.pending = make(map[string]*Verification)
+	}
+	for key, v := range vd.pending {
+		if v == nil || v.User == nil {
+			delete(vd.pending, key)
+		}
+	}
+}
+
+// kickUser removes a user from a chat with a ban followed by an unban, so they may join again later
+func (fh *FeatureHandler) kickUser(chat *tb.Chat, u *tb.User) error {
+	if err := fh.adminHandler.BanUser(chat, u); err != nil {
+		return err
+	}
+	if err := fh.bot.Unban(chat, u, true); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": chat.ID, "user_id": u.ID}).Warn("Failed to unban kicked user")
+	}
+	return nil
+}
+
+// startVerification marks a welcomed user as pending and sets the deadline after an extra delay, returns false if deadlines are disabled
+func (fh *FeatureHandler) startVerification(chat *tb.Chat, u *tb.User, welcome *tb.Message, extra time.Duration) bool {
+	v := &Verification{ChatID: chat.ID, Title: chat.Title, User: u}
+	if fh.verify.timeout > 0 {
+		v.Deadline = time.Now().Add(extra + fh.verify.timeout)
+	}
+	if welcome != nil {
+		v.MessageID = welcome.ID
+	}
+	// A replaced deadline keeps the welcome message and title it doesn't know, and must not leave its reminder behind
+	if old, ok := fh.verify.remove(chat.ID, u.ID); ok {
+		if v.MessageID == 0 {
+			v.MessageID = old.MessageID
+		}
+		if v.Title == "" {
+			v.Title = old.Title
+		}
+		if old.ReminderID != 0 {
+			_ = fh.bot.Delete(&tb.Message{ID: old.ReminderID, Chat: &tb.Chat{ID: old.ChatID}})
+		}
+	}
+	fh.verify.start(v)
+	return !v.Deadline.IsZero()
+}
+
+// verificationDone drops the deadline of a user who verified or left, and removes the reminder
+//
+// With private verification the group welcome only links to the bot, so it is removed as well.
+func (fh *FeatureHandler) verificationDone(chat *tb.Chat, u *tb.User) {
+	v, ok := fh.verify.remove(chat.ID, u.ID)
+	if !ok {
+		return
+	}
+	ids := []int{v.ReminderID}
+	if fh.quiz.Policy(chat.ID).Private {
+		ids = append(ids, v.MessageID)
+	}
+	for _, id := range ids {
+		if id != 0 {
+			_ = fh.bot.Delete(&tb.Message{ID: id, Chat: &tb.Chat{ID: v.ChatID}})
+		}
+	}
+}
+
+// runVerifyExpiry reminds newcomers about their deadline and kicks those who missed it
+func (fh *FeatureHandler) runVerifyExpiry() {
+	ticker := time.NewTicker(verifyCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		remind, expired := fh.verify.due(time.Now())
+		for _, v := range remind {
+			fh.remindVerification(v)
+		}
+		for _, v := range expired {
+			fh.expireVerification(v)
+		}
+	}
+}
+
+// remindVerification warns a newcomer that the deadline is close
+func (fh *FeatureHandler) remindVerification(v Verification) {
+	if !fh.state.IsNewbie(int(v.User.ID)) {
+		fh.verificationDone(&tb.Chat{ID: v.ChatID}, v.User)
+		fh.liftVerified(v)
+		return
+	}
+	lang := fh.getLangForUser(v.User)
+	msgs := i18n.Get().T(lang)
+
+	minutes := int(time.Until(v.Deadline).Round(time.Minute).Minutes())
+	text := fmt.Sprintf(msgs.Verify.Reminder, fh.adminHandler.GetUserDisplayName(v.User), max(minutes, 1))
+	opts := &tb.SendOptions{}
+	if v.MessageID != 0 {
+		opts.ReplyTo = &tb.Message{ID: v.MessageID}
+		opts.AllowWithoutReply = true
+	}
+	msg, err := fh.bot.Send(&tb.Chat{ID: v.ChatID}, text, opts)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": v.ChatID, "user_id": v.User.ID}).Warn("Failed to send verification reminder")
+		return
+	}
+	fh.verify.setReminder(v.ChatID, v.User.ID, msg.ID)
+}
+
+// liftVerified gives send rights back in a chat whose deadline outlived the newcomer flag
+//
+// The flag is global, so a user who verified in another group is still restricted here. A running mute keeps its restriction until it expires.
+func (fh *FeatureHandler) liftVerified(v Verification) {
+	if fh.adminHandler.MutedIn(v.User.ID, v.ChatID) {
+		return
+	}
+	fh.SetUserRestriction(&tb.Chat{ID: v.ChatID}, v.User, true)
+	logrus.WithFields(logrus.Fields{"chat_id": v.ChatID, "user_id": v.User.ID}).Info("Restriction lifted for user verified in another chat")
+}
+
+// expireVerification kicks a newcomer who didn't verify in time and cleans up
+func (fh *FeatureHandler) expireVerification(v Verification) {
+	if _, ok := fh.verify.remove(v.ChatID, v.User.ID); !ok {
+		return
+	}
+	chat := &tb.Chat{ID: v.ChatID, Title: v.Title}
+	for _, id := range []int{v.MessageID, v.ReminderID} {
+		if id != 0 {
+			_ = fh.bot.Delete(&tb.Message{ID: id, Chat: chat})
+		}
+	}
+	uid := int(v.User.ID)
+	if !fh.state.IsNewbie(uid) {
+		fh.liftVerified(v)
+		return
+	}
+
+	if err := fh.kickUser(chat, v.User); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"chat_id": v.ChatID, "user_id": v.User.ID}).Error("Failed to kick unverified user")
+		return
+	}
+	fh.state.ClearNewbie(uid)
+	fh.state.Reset(uid)
+
+	fh.adminHandler.Audit(core.AuditVerifyTimeout, nil, v.User, v.ChatID, "verification timeout", fh.verify.timeout.String())
+	logMsg := fmt.Sprintf("⏰ Пользователь не прошёл верификацию вовремя и удалён из чата.\n\nПользователь: %s\nЧат: %s\nСрок: %s", fh.adminHandler.GetUserDisplayName(v.User), orDash(v.Title), fh.verify.timeout)
+	fh.adminHandler.LogToAdmin(logMsg)
+	logrus.WithFields(logrus.Fields{"chat_id": v.ChatID, "user_id": v.User.ID}).Info("Unverified user kicked after deadline")
+}
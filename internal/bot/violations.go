@@ -0,0 +1,262 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"UEPB/internal/core"
+	"UEPB/internal/i18n"
+
+	"github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v4"
+)
+
+const (
+	maxRecordsPerUser = 20
+	maxExcerptLen     = 200
+)
+
+// ViolationRecord describes a single recorded violation
+type ViolationRecord struct {
+	Rule    string    `json:"rule"`
+	Excerpt string    `json:"excerpt"`
+	ChatID  int64     `json:"chat_id"`
+	Time    time.Time `json:"time"`
+}
+
+// ViolationForgiveButton returns forgive button for the inspector
+func ViolationForgiveButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("viol_forgive", msgs.Admin.ViolationsForgiveButton)
+}
+
+// ViolationEscalateButton returns escalate button for the inspector
+func ViolationEscalateButton() tb.InlineButton {
+	lang := i18n.Get().GetDefault()
+	msgs := i18n.Get().T(lang)
+	return CreateInlineButton("viol_escalate", msgs.Admin.ViolationsEscalateButton)
+}
+
+// ViolationRecords returns a copy of recorded violations for user
+func (ah *AdminHandler) ViolationRecords(userID int64) []ViolationRecord {
+	ah.violationsMu.RLock()
+	defer ah.violationsMu.RUnlock()
+	return append([]ViolationRecord(nil), ah.records[userID]...)
+}
+
+// HandleViolations shows verification status, violations and sanctions of a user
+func (ah *AdminHandler) HandleViolations(c tb.Context) error {
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	if c.Message() == nil || c.Sender() == nil || !ah.IsAdmin(c.Chat(), c.Sender()) {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.ViolationsCommandAdminOnly)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+	// The admin chat usually doesn't contain the user, so a bare ID is enough
+	target := ah.resolveTargetUserOrID(c)
+	if target == nil {
+		msg, _ := ah.bot.Send(c.Chat(), msgs.Admin.ViolationsUsage)
+		ah.DeleteAfter(msg, 10*time.Second)
+		return nil
+	}
+
+	forgiveBtn := ViolationForgiveButton()
+	forgiveBtn.Text = msgs.Admin.ViolationsForgiveButton
+	forgiveBtn.Data = strconv.FormatInt(target.ID, 10)
+	escalateBtn := ViolationEscalateButton()
+	escalateBtn.Text = msgs.Admin.ViolationsEscalateButton
+	escalateBtn.Data = strconv.FormatInt(target.ID, 10)
+	kb := &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{forgiveBtn, escalateBtn}}}
+
+	_, _ = ah.bot.Send(c.Chat(), ah.violationsReport(c.Chat(), target, lang), kb)
+	return nil
+}
+
+// violationsReport builds the inspector text for a user
+func (ah *AdminHandler) violationsReport(chat *tb.Chat, user *tb.User, lang i18n.Lang) string {
+	msgs := i18n.Get().T(lang)
+
+	var sb strings.Builder
+	name := fmt.Sprintf("ID: %d", user.ID)
+	if user.Username != "" || user.FirstName != "" {
+		name = ah.GetUserDisplayName(user)
+	}
+	sb.WriteString(fmt.Sprintf(msgs.Admin.ViolationsHeader, name))
+	sb.WriteString("\n\n")
+
+	uid := int(user.ID)
+	if ah.state != nil && ah.state.IsNewbie(uid) {
+		sb.WriteString(fmt.Sprintf(msgs.Admin.ViolationsStatusNewbie, ah.state.TotalCorrect(uid)))
+	} else {
+		sb.WriteString(msgs.Admin.ViolationsStatusVerified)
+	}
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf(msgs.Admin.ViolationsCount, ah.GetViolations(user.ID)))
+	sb.WriteString("\n\n")
+
+	records := ah.ViolationRecords(user.ID)
+	if len(records) == 0 {
+		sb.WriteString(msgs.Admin.ViolationsNone)
+		sb.WriteString("\n")
+	}
+	for i, r := range records {
+		sb.WriteString(fmt.Sprintf(msgs.Admin.ViolationsRecord, i+1, r.Time.Format("2006-01-02 15:04"), r.Rule, r.Excerpt))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+
+	sanctions := ah.activeSanctions(chat, user, lang)
+	if len(sanctions) == 0 {
+		sb.WriteString(msgs.Admin.ViolationsNoSanctions)
+	}
+	for _, s := range sanctions {
+		sb.WriteString(s)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// activeSanctions lists bans and mutes of a user in known groups
+func (ah *AdminHandler) activeSanctions(chat *tb.Chat, user *tb.User, lang i18n.Lang) []string {
+	msgs := i18n.Get().T(lang)
+
+	chatIDs := ah.AllGroupIDs()
+	if chat != nil && chat.Type != tb.ChatPrivate && chat.ID != ah.adminChatID {
+		found := false
+		for _, id := range chatIDs {
+			if id == chat.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			chatIDs = append(chatIDs, chat.ID)
+		}
+	}
+
+	var lines []string
+	for _, chatID := range chatIDs {
+		member, err := ah.bot.ChatMemberOf(&tb.Chat{ID: chatID}, user)
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"chat_id": chatID, "user_id": user.ID}).Debug("Failed to get member for sanctions")
+			continue
+		}
+		switch {
+		case member.Role == tb.Kicked:
+			lines = append(lines, fmt.Sprintf(msgs.Admin.ViolationsBanned, chatID))
+		case member.Role == tb.Restricted && !member.CanSendMessages:
+			if member.RestrictedUntil > 0 {
+				until := time.Unix(member.RestrictedUntil, 0).Format("2006-01-02 15:04")
+				lines = append(lines, fmt.Sprintf(msgs.Admin.ViolationsMutedUntil, chatID, until))
+			} else {
+				lines = append(lines, fmt.Sprintf(msgs.Admin.ViolationsMuted, chatID))
+			}
+		}
+	}
+	return lines
+}
+
+// violationCallbackTarget validates the clicker and parses the target user ID
+func (ah *AdminHandler) violationCallbackTarget(c tb.Context) (int64, bool) {
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	cb := c.Callback()
+	if cb == nil || c.Sender() == nil || c.Chat() == nil {
+		return 0, false
+	}
+	if !ah.IsAdmin(c.Chat(), c.Sender()) {
+		_ = ah.bot.Respond(cb, &tb.CallbackResponse{Text: msgs.Buttons.NotYourButton})
+		return 0, false
+	}
+	id, err := strconv.ParseInt(cb.Data, 10, 64)
+	if err != nil {
+		_ = ah.bot.Respond(cb)
+		return 0, false
+	}
+	return id, true
+}
+
+// HandleViolationForgive clears violations of the inspected user
+func (ah *AdminHandler) HandleViolationForgive(c tb.Context) error {
+	userID, ok := ah.violationCallbackTarget(c)
+	if !ok {
+		return nil
+	}
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	ah.ClearViolations(userID)
+	ah.Audit(core.AuditForgive, c.Sender(), &tb.User{ID: userID}, c.Chat().ID, "violations inspector", "")
+	note := fmt.Sprintf(msgs.Admin.ViolationsForgiven, ah.GetUserDisplayName(c.Sender()))
+	_ = ah.bot.Respond(c.Callback(), &tb.CallbackResponse{Text: note})
+	_, _ = ah.bot.Edit(c.Message(), c.Message().Text+"\n\n"+note)
+	ah.LogToAdmin(fmt.Sprintf("🙏 Нарушения пользователя прощены.\n\nПользователь: ID %d\nАдмин: %s", userID, ah.GetUserDisplayName(c.Sender())))
+	return nil
+}
+
+// HandleViolationEscalate bans the inspected user everywhere
+func (ah *AdminHandler) HandleViolationEscalate(c tb.Context) error {
+	userID, ok := ah.violationCallbackTarget(c)
+	if !ok {
+		return nil
+	}
+	lang := ah.getLangForUser(c.Sender())
+	msgs := i18n.Get().T(lang)
+
+	// The button lives in the admin chat, admins of the groups the ban reaches must be protected as well
+	user := &tb.User{ID: userID}
+	if ah.IsAdminAnywhere(user) {
+		_ = ah.bot.Respond(c.Callback(), &tb.CallbackResponse{Text: msgs.Admin.SpambanCannotBanAdmin})
+		return nil
+	}
+	purged := ah.BanUserEverywhere(user, "violations inspector", "", c.Sender())
+	ah.Audit(core.AuditSpamBan, c.Sender(), user, c.Chat().ID, "violations inspector", "")
+	ah.ClearViolations(userID)
+	note := fmt.Sprintf(msgs.Admin.ViolationsEscalated, ah.GetUserDisplayName(c.Sender()))
+	_ = ah.bot.Respond(c.Callback(), &tb.CallbackResponse{Text: note})
+	_, _ = ah.bot.Edit(c.Message(), c.Message().Text+"\n\n"+note)
+	ah.LogToAdmin(fmt.Sprintf("🔨 Пользователь забанен во всех группах.\n\nПользователь: ID %d\nАдмин: %s\nУдалено сообщений: %d", userID, ah.GetUserDisplayName(c.Sender()), purged))
+	return nil
+}
+
+// truncate shortens text to n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
+
+// saveRecords persists violation records to disk
+func (ah *AdminHandler) saveRecords() {
+	ah.violationsMu.RLock()
+	data, err := json.MarshalIndent(ah.records, "", "  ")
+	ah.violationsMu.RUnlock()
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(ah.recordsFile, data, 0644)
+}
+
+// loadRecords reads violation records from disk
+func (ah *AdminHandler) loadRecords() {
+	data, err := os.ReadFile(ah.recordsFile)
+	if err != nil {
+		return
+	}
+	ah.violationsMu.Lock()
+	_ = json.Unmarshal(data, &ah.records)
+	if ah.records == nil {
+		ah.records = make(map[int64][]ViolationRecord)
+	}
+	ah.violationsMu.Unlock()
+}
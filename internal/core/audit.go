@@ -0,0 +1,70 @@
+package core
+
+import "time"
+
+// Audit actions
+const (
+	AuditBanWord        = "banword"
+	AuditUnbanWord      = "unbanword"
+	AuditSpamBan        = "spamban"
+	AuditUnspamBan      = "unspamban"
+	AuditGlobalBanJoin  = "global_ban_join"
+	AuditViolation      = "violation"
+	AuditAutoBan        = "autoban"
+	AuditForgive        = "forgive"
+	AuditQuizPassed     = "quiz_passed"
+	AuditQuizFailed     = "quiz_failed"
+	AuditGuest          = "guest"
+	AuditAppealApproved = "appeal_approved"
+	AuditAppealRejected = "appeal_rejected"
+	AuditUnrestrict     = "unrestrict"
+	AuditRequiz         = "requiz"
+	AuditMute           = "mute"
+	AuditUnmute         = "unmute"
+	AuditBanExpired     = "ban_expired"
+	AuditFloodMute      = "flood_mute"
+	AuditDuplicate      = "duplicate"
+	AuditPremodApproved = "premod_approved"
+	AuditPremodRejected = "premod_rejected"
+	AuditScreenBan      = "screen_ban"
+	AuditScreenRestrict = "screen_restrict"
+	AuditScreenFlag     = "screen_flag"
+	AuditBanListJoin    = "banlist_join"
+	AuditLockdownStart  = "lockdown_start"
+	AuditLockdownEnd    = "lockdown_end"
+	AuditLock           = "lock"
+	AuditUnlock         = "unlock"
+	AuditVerifyTimeout  = "verify_timeout"
+	AuditEmailVerified  = "email_verified"
+	AuditCaptchaPassed  = "captcha_passed"
+	AuditCaptchaFailed  = "captcha_failed"
+	AuditMuteExpired    = "mute_expired"
+)
+
+// AuditEvent is a single structured moderation event
+type AuditEvent struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	ActorID  int64     `json:"actor_id,omitempty"`
+	Actor    string    `json:"actor,omitempty"`
+	TargetID int64     `json:"target_id,omitempty"`
+	Target   string    `json:"target,omitempty"`
+	ChatID   int64     `json:"chat_id,omitempty"`
+	Rule     string    `json:"rule,omitempty"`
+	Details  string    `json:"details,omitempty"`
+}
+
+// AuditFilter selects audit events, zero fields match everything
+type AuditFilter struct {
+	Actor  string
+	Target string
+	Action string
+	From   time.Time
+	To     time.Time
+}
+
+// AuditLogInterface persistent moderation audit log
+type AuditLogInterface interface {
+	Record(ev AuditEvent)
+	Query(f AuditFilter) ([]AuditEvent, error)
+}
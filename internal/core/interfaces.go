@@ -15,18 +15,79 @@ type UserState interface {
 	SetNewbie(id int)
 	ClearNewbie(id int)
 	IsNewbie(id int) bool
+	SetJoined(id int, t time.Time)
+	JoinedAt(id int) time.Time
+	StartPremod(id int)
+	ClearPremod(id int)
+	IsPremod(id int) bool
+	IncPremodApproved(id int) int
+	SetQuizPlan(id int, groupID int64, questions []string, passScore int)
+	SetQuizMessage(id int, chatID int64, msgID int)
+	QuizPlan(id int) (QuizPlan, bool)
+	AdvanceQuiz(id int, question string) (QuizPlan, bool)
+	AddQuizFail(chatID int64, id int, t time.Time, ttl time.Duration) int
+	LastQuizFail(chatID int64, id int) (int, time.Time)
+	ClearQuizFails(chatID int64, id int)
 }
 
 // QuestionInterface single quiz question
 type QuestionInterface interface {
+	GetID() string
 	GetText() string
 	GetButtons() []tb.InlineButton
 	GetAnswer() string
+	GetExplanation() string
 }
 
-// QuizInterface collection of questions
+// Outcomes of a failed quiz once attempts run out
+const (
+	QuizFailGuest = "guest"
+	QuizFailKick  = "kick"
+)
+
+// Verification methods, the quiz and e-mail verify students, the others are CAPTCHAs shown right in the welcome
+const (
+	VerifyQuiz       = "quiz"
+	VerifyEmail      = "email"
+	VerifyArithmetic = "arithmetic"
+	VerifyEmoji      = "emoji"
+	VerifyImage      = "image"
+)
+
+// QuizPolicy controls the verification method, retries of a failed quiz in a chat and whether it runs in a private chat
+type QuizPolicy struct {
+	Method   string
+	Attempts int
+	Cooldown time.Duration
+	FailTTL  time.Duration
+	OnFail   string
+	Private  bool
+}
+
+// Mailer sends plain text e-mail
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// Challenge is a CAPTCHA, Prompt is shown in the question, Image is a PNG sent with it if set, Options[Answer] is right
+type Challenge struct {
+	Prompt  string
+	Image   []byte
+	Options []string
+	Answer  int
+}
+
+// Verifier creates challenges of a CAPTCHA method
+type Verifier interface {
+	NewChallenge() Challenge
+}
+
+// QuizInterface provides quiz questions per chat and language
 type QuizInterface interface {
-	GetQuestions() []QuestionInterface
+	NewPlan(chatID int64) (questions []string, passScore int)
+	GetQuestion(chatID int64, lang, id string) (QuestionInterface, bool)
+	PassScore(chatID int64) int
+	Policy(chatID int64) QuizPolicy
 }
 
 // BlacklistInterface operations for banned phrases
@@ -35,20 +96,48 @@ type BlacklistInterface interface {
 	RemovePhrase(words []string) bool
 	List() [][]string
 	CheckMessage(msg string) bool
+	Match(msg string) ([]string, bool)
 }
 
 // AdminHandlerInterface admin tools
 type AdminHandlerInterface interface {
 	LogToAdmin(message string)
+	LogToAdminWithMarkup(message string, rm *tb.ReplyMarkup)
+	Audit(action string, actor, target *tb.User, chatID int64, rule, details string)
 	IsAdmin(chat *tb.Chat, user *tb.User) bool
 	GetUserDisplayName(user *tb.User) string
 	DeleteAfter(m *tb.Message, d time.Duration)
 	BanUser(chat *tb.Chat, user *tb.User) error
+	MuteUser(chat *tb.Chat, user *tb.User, d time.Duration) time.Time
+	BanUserEverywhere(user *tb.User, reason, excerpt string, admin *tb.User) int
+	IsGloballyBanned(userID int64) bool
+	LiftGlobalBan(user *tb.User)
+	MutedIn(userID, chatID int64) bool
+	RegisterGroup(chat *tb.Chat)
+	UnregisterGroup(chatID int64)
+	AllGroupIDs() []int64
+	MigrateGroup(from, to int64)
+	TrackGroups(next tb.HandlerFunc) tb.HandlerFunc
+	TrackMessages(next tb.HandlerFunc) tb.HandlerFunc
+	PurgeUserMessages(userID int64) int
+	HandleMyChatMember(c tb.Context) error
+	HandleMigration(c tb.Context) error
 	HandleBan(c tb.Context) error
 	HandleUnban(c tb.Context) error
 	HandleListBan(c tb.Context) error
 	HandleSpamBan(c tb.Context) error
-	AddViolation(userID int64)
+	HandleUnspamBan(c tb.Context) error
+	HandleAudit(c tb.Context) error
+	HandleMute(c tb.Context) error
+	HandleUnmute(c tb.Context) error
+	HandleViolations(c tb.Context) error
+	HandleViolationForgive(c tb.Context) error
+	HandleViolationEscalate(c tb.Context) error
+	HandleAppeal(c tb.Context) error
+	HandleAppealApprove(c tb.Context) error
+	HandleAppealReject(c tb.Context) error
+	RecordBan(user *tb.User, chatID int64, reason, excerpt string, admin *tb.User)
+	AddViolation(userID, chatID int64, rule, excerpt string)
 	GetViolations(userID int64) int
 	ClearViolations(userID int64)
 	Bot() *tb.Bot
@@ -69,6 +158,46 @@ type FeatureHandlerInterface interface {
 	HandlePrivateMessage(c tb.Context) error
 	RateLimit(handler func(tb.Context) error) func(tb.Context) error
 	RegisterQuizHandlers(bot *tb.Bot)
-	CreateQuizHandler(i int, q QuestionInterface, btn tb.InlineButton) func(tb.Context) error
+	HandleQuizAnswer(c tb.Context) error
 	FilterMessage(c tb.Context) error
+	HandleLogAction(c tb.Context) error
+	HandleFlood(c tb.Context) error
+	HandleLock(c tb.Context) error
+	HandleUnlock(c tb.Context) error
+	HandleLocks(c tb.Context) error
+	HandleDuplicateBanAll(c tb.Context) error
+	HandlePremod(c tb.Context) error
+	HandleLockdownEnd(c tb.Context) error
+	MigrateChat(from, to int64)
+}
+
+// Join screening outcomes
+const (
+	ScreenAllow    = "allow"
+	ScreenFlag     = "flag"
+	ScreenRestrict = "restrict"
+	ScreenBan      = "ban"
+)
+
+// ScreenVerdict result of join screening
+type ScreenVerdict struct {
+	Action  string
+	Score   int
+	Signals []string
+}
+
+// JoinScreener scores profile signals of a joining user
+type JoinScreener interface {
+	Screen(user *tb.User) ScreenVerdict
+}
+
+// SpamClassifierInterface trainable spam classifier
+type SpamClassifierInterface interface {
+	Train(text string, spam bool)
+	Score(text string) (float64, bool)
+}
+
+// BanListProvider looks up users in an external anti-spam database
+type BanListProvider interface {
+	Lookup(userID int64) (listed bool, reason string, err error)
 }
@@ -0,0 +1,24 @@
+package core
+
+// FloodSettings thresholds of the flood detector
+type FloodSettings struct {
+	Disabled     bool `json:"disabled"`
+	MaxMessages  int  `json:"max_messages"`
+	WindowSec    int  `json:"window_sec"`
+	MaxIdentical int  `json:"max_identical"`
+	MaxLines     int  `json:"max_lines"`
+	MuteMinutes  int  `json:"mute_minutes"`
+}
+
+// ChatSettings per-chat moderation settings
+type ChatSettings struct {
+	Flood FloodSettings `json:"flood"`
+	Locks []string      `json:"locks,omitempty"`
+}
+
+// ChatSettingsInterface persistent per-chat settings
+type ChatSettingsInterface interface {
+	Get(chatID int64) ChatSettings
+	Update(chatID int64, fn func(s *ChatSettings))
+	Migrate(from, to int64)
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -13,9 +15,32 @@ import (
 // State holds user quiz results and newbie flags
 type State struct {
 	mu          sync.RWMutex
-	UserCorrect map[int]int  `json:"user_correct"`
-	NewbieMap   map[int]bool `json:"is_newbie"`
-	File        string       `json:"-"`
+	UserCorrect map[int]int          `json:"user_correct"`
+	NewbieMap   map[int]bool         `json:"is_newbie"`
+	JoinedMap   map[int]int64        `json:"joined_at"`
+	PremodMap   map[int]int          `json:"premod"`
+	QuizPlans   map[int]*QuizPlan    `json:"quiz_plans"`
+	QuizFails   map[string]*QuizFail `json:"quiz_fails"`
+	File        string               `json:"-"`
+}
+
+// QuizPlan is the question sequence drawn for a user, the position in it and the message showing it
+//
+// GroupID is the chat being verified for, it differs from ChatID when the quiz runs in a private chat.
+// PassScore is fixed when the questions are drawn, so a quiz reload can't change the rules mid-quiz.
+type QuizPlan struct {
+	GroupID   int64    `json:"group_id"`
+	Questions []string `json:"questions"`
+	PassScore int      `json:"pass_score,omitempty"`
+	Step      int      `json:"step"`
+	ChatID    int64    `json:"chat_id,omitempty"`
+	MessageID int      `json:"message_id,omitempty"`
+}
+
+// QuizFail counts failed verification attempts of a user in a chat and remembers the last one
+type QuizFail struct {
+	Count int   `json:"count"`
+	At    int64 `json:"at"`
 }
 
 // NewState allocates a new State and loads persisted data
@@ -26,7 +51,7 @@ func NewState() UserState {
 	if !strings.HasPrefix(file, "data/") {
 		file = "data/" + file
 	}
-	s := &State{UserCorrect: make(map[int]int), NewbieMap: make(map[int]bool), File: file}
+	s := &State{UserCorrect: make(map[int]int), NewbieMap: make(map[int]bool), JoinedMap: make(map[int]int64), PremodMap: make(map[int]int), QuizPlans: make(map[int]*QuizPlan), QuizFails: make(map[string]*QuizFail), File: file}
 	s.load()
 	return s
 }
@@ -41,12 +66,155 @@ func (s *State) TotalCorrect(id int) int {
 	return v
 }
 
-// Reset resets user correct count
-func (s *State) Reset(id int)         { s.mu.Lock(); delete(s.UserCorrect, id); s.mu.Unlock(); s.save() }
+// Reset resets user correct count and quiz plan
+func (s *State) Reset(id int) {
+	s.mu.Lock()
+	delete(s.UserCorrect, id)
+	delete(s.QuizPlans, id)
+	s.mu.Unlock()
+	s.save()
+}
 func (s *State) SetNewbie(id int)     { s.mu.Lock(); s.NewbieMap[id] = true; s.mu.Unlock(); s.save() }
-func (s *State) ClearNewbie(id int)   { s.mu.Lock(); delete(s.NewbieMap, id); s.mu.Unlock(); s.save() }
 func (s *State) IsNewbie(id int) bool { s.mu.RLock(); v := s.NewbieMap[id]; s.mu.RUnlock(); return v }
 
+// ClearNewbie drops the newbie flag, failed attempts outlive it so leaving and rejoining doesn't reset them
+func (s *State) ClearNewbie(id int) { s.mu.Lock(); delete(s.NewbieMap, id); s.mu.Unlock(); s.save() }
+
+// SetJoined remembers when the user joined a group
+func (s *State) SetJoined(id int, t time.Time) {
+	s.mu.Lock()
+	s.JoinedMap[id] = t.Unix()
+	s.mu.Unlock()
+	s.save()
+}
+
+// JoinedAt returns when the user joined, zero if unknown
+func (s *State) JoinedAt(id int) time.Time {
+	s.mu.RLock()
+	v, ok := s.JoinedMap[id]
+	s.mu.RUnlock()
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
+
+// StartPremod puts the user under pre-moderation with no approved messages
+func (s *State) StartPremod(id int) { s.mu.Lock(); s.PremodMap[id] = 0; s.mu.Unlock(); s.save() }
+func (s *State) ClearPremod(id int) { s.mu.Lock(); delete(s.PremodMap, id); s.mu.Unlock(); s.save() }
+func (s *State) IsPremod(id int) bool {
+	s.mu.RLock()
+	_, ok := s.PremodMap[id]
+	s.mu.RUnlock()
+	return ok
+}
+
+// IncPremodApproved counts an approved message of a pre-moderated user and returns the total
+func (s *State) IncPremodApproved(id int) int {
+	s.mu.Lock()
+	v, ok := s.PremodMap[id]
+	if ok {
+		v++
+		s.PremodMap[id] = v
+	}
+	s.mu.Unlock()
+	s.save()
+	return v
+}
+
+// SetQuizPlan stores the questions drawn for the user verifying for a group
+func (s *State) SetQuizPlan(id int, groupID int64, questions []string, passScore int) {
+	s.mu.Lock()
+	s.QuizPlans[id] = &QuizPlan{GroupID: groupID, Questions: questions, PassScore: passScore}
+	s.mu.Unlock()
+	s.save()
+}
+
+// SetQuizMessage remembers the message the user's quiz is shown in
+func (s *State) SetQuizMessage(id int, chatID int64, msgID int) {
+	s.mu.Lock()
+	p, ok := s.QuizPlans[id]
+	if ok {
+		p.ChatID, p.MessageID = chatID, msgID
+	}
+	s.mu.Unlock()
+	if ok {
+		s.save()
+	}
+}
+
+// QuizPlan returns a copy of the user's quiz plan
+func (s *State) QuizPlan(id int) (QuizPlan, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.QuizPlans[id]
+	if !ok {
+		return QuizPlan{}, false
+	}
+	return *p, true
+}
+
+// AdvanceQuiz moves the plan past the question if it is the current one, so a question can't be answered twice
+func (s *State) AdvanceQuiz(id int, question string) (QuizPlan, bool) {
+	s.mu.Lock()
+	p, ok := s.QuizPlans[id]
+	if !ok || p.Step >= len(p.Questions) || p.Questions[p.Step] != question {
+		s.mu.Unlock()
+		return QuizPlan{}, false
+	}
+	p.Step++
+	plan := *p
+	s.mu.Unlock()
+	s.save()
+	return plan, true
+}
+
+// quizFailKey returns the key of a user's failed attempts in a chat
+func quizFailKey(chatID int64, id int) string {
+	return strconv.FormatInt(chatID, 10) + ":" + strconv.Itoa(id)
+}
+
+// AddQuizFail records a failed attempt in a chat and returns the number of failures, attempts older than ttl are forgotten
+func (s *State) AddQuizFail(chatID int64, id int, t time.Time, ttl time.Duration) int {
+	s.mu.Lock()
+	for k, f := range s.QuizFails {
+		if t.Sub(time.Unix(f.At, 0)) > ttl {
+			delete(s.QuizFails, k)
+		}
+	}
+	key := quizFailKey(chatID, id)
+	f, ok := s.QuizFails[key]
+	if !ok {
+		f = &QuizFail{}
+		s.QuizFails[key] = f
+	}
+	f.Count++
+	f.At = t.Unix()
+	n := f.Count
+	s.mu.Unlock()
+	s.save()
+	return n
+}
+
+// LastQuizFail returns the number of failed attempts in a chat and when the last one happened
+func (s *State) LastQuizFail(chatID int64, id int) (int, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.QuizFails[quizFailKey(chatID, id)]
+	if !ok {
+		return 0, time.Time{}
+	}
+	return f.Count, time.Unix(f.At, 0)
+}
+
+// ClearQuizFails forgets failed attempts in a chat
+func (s *State) ClearQuizFails(chatID int64, id int) {
+	s.mu.Lock()
+	delete(s.QuizFails, quizFailKey(chatID, id))
+	s.mu.Unlock()
+	s.save()
+}
+
 // save saves state to file
 func (s *State) save() {
 	data, err := json.MarshalIndent(s, "", "  ")
@@ -74,4 +242,16 @@ func (s *State) load() {
 	if s.NewbieMap == nil {
 		s.NewbieMap = make(map[int]bool)
 	}
+	if s.JoinedMap == nil {
+		s.JoinedMap = make(map[int]int64)
+	}
+	if s.PremodMap == nil {
+		s.PremodMap = make(map[int]int)
+	}
+	if s.QuizPlans == nil {
+		s.QuizPlans = make(map[int]*QuizPlan)
+	}
+	if s.QuizFails == nil {
+		s.QuizFails = make(map[string]*QuizFail)
+	}
 }
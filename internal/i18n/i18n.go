@@ -20,6 +20,9 @@ const (
 	BE Lang = "be"
 )
 
+// Languages lists all supported languages
+var Languages = []Lang{PL, EN, RU, UK, BE}
+
 // Messages holds all translations
 type Messages struct {
 	Welcome struct {
@@ -36,9 +39,11 @@ type Messages struct {
 	Quiz struct {
 		VerificationPassed string `toml:"verification_passed"`
 		VerificationFailed string `toml:"verification_failed"`
-		Question1          string `toml:"question_1"`
-		Question2          string `toml:"question_2"`
-		Question3          string `toml:"question_3"`
+		Progress           string `toml:"progress"`
+		RetryButton        string `toml:"retry_button"`
+		RetryIn            string `toml:"retry_in"`
+		RetryWait          string `toml:"retry_wait"`
+		FailedKicked       string `toml:"failed_kicked"`
 	} `toml:"quiz"`
 	Guest struct {
 		CanWrite string `toml:"can_write"`
@@ -70,9 +75,123 @@ type Messages struct {
 		ListHeader              string `toml:"list_header"`
 		SpambanCommandAdminOnly string `toml:"spamban_command_admin_only"`
 		SpambanUserNotFound     string `toml:"spamban_user_not_found"`
+		SpambanUsage            string `toml:"spamban_usage"`
 		SpambanCannotBanAdmin   string `toml:"spamban_cannot_ban_admin"`
 		SpambanSuccess          string `toml:"spamban_success"`
+		SpambanSuccessUntil     string `toml:"spamban_success_until"`
+		SpambanPurged           string `toml:"spamban_purged"`
+
+		MuteCommandAdminOnly string `toml:"mute_command_admin_only"`
+		MuteUsage            string `toml:"mute_usage"`
+		MuteCannotMuteAdmin  string `toml:"mute_cannot_mute_admin"`
+		MuteSuccess          string `toml:"mute_success"`
+		UnmuteSuccess        string `toml:"unmute_success"`
+
+		UnspambanCommandAdminOnly string `toml:"unspamban_command_admin_only"`
+		UnspambanUsage            string `toml:"unspamban_usage"`
+		UnspambanNotFound         string `toml:"unspamban_not_found"`
+		UnspambanSuccess          string `toml:"unspamban_success"`
+
+		AuditCommandAdminOnly string `toml:"audit_command_admin_only"`
+		AuditUsage            string `toml:"audit_usage"`
+		AuditEmpty            string `toml:"audit_empty"`
+		AuditHeader           string `toml:"audit_header"`
+		AuditExported         string `toml:"audit_exported"`
+
+		ViolationsCommandAdminOnly string `toml:"violations_command_admin_only"`
+		ViolationsUsage            string `toml:"violations_usage"`
+		ViolationsHeader           string `toml:"violations_header"`
+		ViolationsStatusNewbie     string `toml:"violations_status_newbie"`
+		ViolationsStatusVerified   string `toml:"violations_status_verified"`
+		ViolationsCount            string `toml:"violations_count"`
+		ViolationsNone             string `toml:"violations_none"`
+		ViolationsRecord           string `toml:"violations_record"`
+		ViolationsNoSanctions      string `toml:"violations_no_sanctions"`
+		ViolationsBanned           string `toml:"violations_banned"`
+		ViolationsMuted            string `toml:"violations_muted"`
+		ViolationsMutedUntil       string `toml:"violations_muted_until"`
+		ViolationsForgiveButton    string `toml:"violations_forgive_button"`
+		ViolationsEscalateButton   string `toml:"violations_escalate_button"`
+		ViolationsForgiven         string `toml:"violations_forgiven"`
+		ViolationsEscalated        string `toml:"violations_escalated"`
 	} `toml:"admin"`
+	LogActions struct {
+		Ban         string `toml:"ban"`
+		Forgive     string `toml:"forgive"`
+		Unrestrict  string `toml:"unrestrict"`
+		Requiz      string `toml:"requiz"`
+		Blacklist   string `toml:"blacklist"`
+		DoneBy      string `toml:"done_by"`
+		Expired     string `toml:"expired"`
+		BanAll      string `toml:"ban_all"`
+		EndLockdown string `toml:"end_lockdown"`
+	} `toml:"log_actions"`
+	Appeal struct {
+		PrivateOnly     string `toml:"private_only"`
+		NoBan           string `toml:"no_ban"`
+		AlreadyPending  string `toml:"already_pending"`
+		AlreadyReviewed string `toml:"already_reviewed"`
+		AlreadyHandled  string `toml:"already_handled"`
+		Sent            string `toml:"sent"`
+		Approved        string `toml:"approved"`
+		Rejected        string `toml:"rejected"`
+		ApproveButton   string `toml:"approve_button"`
+		RejectButton    string `toml:"reject_button"`
+		ApprovedBy      string `toml:"approved_by"`
+		RejectedBy      string `toml:"rejected_by"`
+	} `toml:"appeal"`
+	Flood struct {
+		CommandAdminOnly string `toml:"command_admin_only"`
+		Usage            string `toml:"usage"`
+		Status           string `toml:"status"`
+		On               string `toml:"on"`
+		Off              string `toml:"off"`
+		Muted            string `toml:"muted"`
+	} `toml:"flood"`
+	Locks struct {
+		CommandAdminOnly string `toml:"command_admin_only"`
+		Usage            string `toml:"usage"`
+		Locked           string `toml:"locked"`
+		Unlocked         string `toml:"unlocked"`
+		List             string `toml:"list"`
+		None             string `toml:"none"`
+		Deleted          string `toml:"deleted"`
+	} `toml:"locks"`
+	Hidden struct {
+		Deleted string `toml:"deleted"`
+		Muted   string `toml:"muted"`
+	} `toml:"hidden"`
+	Verify struct {
+		Reminder      string `toml:"reminder"`
+		Button        string `toml:"button"`
+		PrivatePrompt string `toml:"private_prompt"`
+		NotPending    string `toml:"not_pending"`
+	} `toml:"verify"`
+	Email struct {
+		AskAddress   string `toml:"ask_address"`
+		BadAddress   string `toml:"bad_address"`
+		AlreadyUsed  string `toml:"already_used"`
+		CodeSent     string `toml:"code_sent"`
+		SendFailed   string `toml:"send_failed"`
+		WrongCode    string `toml:"wrong_code"`
+		CodeExpired  string `toml:"code_expired"`
+		TooManySends string `toml:"too_many_sends"`
+		Subject      string `toml:"subject"`
+		Body         string `toml:"body"`
+	} `toml:"email"`
+	Captcha struct {
+		Arithmetic string `toml:"arithmetic"`
+		Emoji      string `toml:"emoji"`
+		Image      string `toml:"image"`
+		Wrong      string `toml:"wrong"`
+	} `toml:"captcha"`
+	Premod struct {
+		Held          string `toml:"held"`
+		Reposted      string `toml:"reposted"`
+		RepostedMedia string `toml:"reposted_media"`
+		ApproveButton string `toml:"approve_button"`
+		RejectButton  string `toml:"reject_button"`
+	} `toml:"premod"`
 	Start struct {
 		Greeting string `toml:"greeting"`
 	} `toml:"start"`
@@ -82,6 +201,16 @@ type Messages struct {
 		UnbanwordDesc   string `toml:"unbanword_desc"`
 		ListbanwordDesc string `toml:"listbanword_desc"`
 		SpambanDesc     string `toml:"spamban_desc"`
+		ViolationsDesc  string `toml:"violations_desc"`
+		AppealDesc      string `toml:"appeal_desc"`
+		UnspambanDesc   string `toml:"unspamban_desc"`
+		AuditDesc       string `toml:"audit_desc"`
+		MuteDesc        string `toml:"mute_desc"`
+		UnmuteDesc      string `toml:"unmute_desc"`
+		FloodDesc       string `toml:"flood_desc"`
+		LockDesc        string `toml:"lock_desc"`
+		UnlockDesc      string `toml:"unlock_desc"`
+		LocksDesc       string `toml:"locks_desc"`
 	} `toml:"commands"`
 }
 
@@ -105,8 +234,7 @@ func Init(defaultLang Lang) error {
 		}
 
 		// Load all languages
-		langs := []Lang{PL, EN, RU, UK, BE}
-		for _, lang := range langs {
+		for _, lang := range Languages {
 			if err := globalLocalizer.loadLanguage(lang); err != nil {
 				initErr = fmt.Errorf("failed to load %s: %w", lang, err)
 				return
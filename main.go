@@ -77,8 +77,20 @@ func main() {
 func NewHandler(b *tb.Bot, adminChatID int64) *Handler {
 	violations := make(map[int64]int)
 	state := core.NewState()
-	quiz := bot.DefaultQuiz()
+	quizFile := os.Getenv("QUIZ_FILE")
+	if quizFile == "" {
+		quizFile = "quiz.toml"
+	}
+	quiz, err := bot.NewQuiz(quizFile)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load quiz")
+	}
 	black := bot.NewBlacklist("blacklist.json")
+	audit := bot.NewAuditLog("audit.jsonl")
+	settings := bot.NewSettings("chat_settings.json")
+	screener := bot.NewProfileScreener(b, black)
+	classifier := bot.NewBayes("bayes.json")
+	banList := bot.BanListFromEnv()
 
 	h := &Handler{bot: b, state: state, quiz: quiz, blacklist: black, adminChatID: adminChatID, violations: violations}
 
@@ -88,17 +100,20 @@ func NewHandler(b *tb.Bot, adminChatID int64) *Handler {
 	h.Btns.Ads = bot.AdsButton()
 
 	// Admin
-	adminHandler := bot.NewAdminHandler(b, black, adminChatID, violations)
+	adminHandler := bot.NewAdminHandler(b, state, black, audit, classifier, adminChatID, violations)
 	h.adminHandler = adminHandler
 
 	// Feature
-	featureHandler := bot.NewFeatureHandler(b, state, quiz, black, adminChatID, violations, adminHandler, h.Btns)
+	featureHandler := bot.NewFeatureHandler(b, state, quiz, black, adminChatID, violations, adminHandler, settings, screener, banList, classifier, bot.MailerFromEnv(), h.Btns)
 	h.featureHandler = featureHandler
 	return h
 }
 
 // Register sets handlers
 func (h *Handler) Register() {
+	h.bot.Use(h.adminHandler.TrackGroups, h.adminHandler.TrackMessages)
+	h.bot.Handle(tb.OnMyChatMember, h.adminHandler.HandleMyChatMember)
+	h.bot.Handle(tb.OnMigration, h.handleMigration)
 	h.bot.Handle(tb.OnUserJoined, h.featureHandler.HandleUserJoined)
 	h.bot.Handle(tb.OnUserLeft, h.featureHandler.HandleUserLeft)
 	h.bot.Handle(&h.Btns.Student, h.featureHandler.OnlyNewbies(h.featureHandler.HandleStudent))
@@ -109,18 +124,74 @@ func (h *Handler) Register() {
 	h.bot.Handle("/unbanword", h.adminHandler.HandleUnban)
 	h.bot.Handle("/listbanword", h.adminHandler.HandleListBan)
 	h.bot.Handle("/spamban", h.adminHandler.HandleSpamBan)
+	h.bot.Handle("/unspamban", h.adminHandler.HandleUnspamBan)
+	h.bot.Handle("/mute", h.adminHandler.HandleMute)
+	h.bot.Handle("/unmute", h.adminHandler.HandleUnmute)
+	h.bot.Handle("/violations", h.adminHandler.HandleViolations)
+	h.bot.Handle("/audit", h.adminHandler.HandleAudit)
+	h.bot.Handle("/flood", h.featureHandler.HandleFlood)
+	h.bot.Handle("/lock", h.featureHandler.HandleLock)
+	h.bot.Handle("/unlock", h.featureHandler.HandleUnlock)
+	h.bot.Handle("/locks", h.featureHandler.HandleLocks)
+	forgiveBtn, escalateBtn := bot.ViolationForgiveButton(), bot.ViolationEscalateButton()
+	h.bot.Handle(&forgiveBtn, h.adminHandler.HandleViolationForgive)
+	h.bot.Handle(&escalateBtn, h.adminHandler.HandleViolationEscalate)
+	logActionBtn := bot.LogActionButton()
+	h.bot.Handle(&logActionBtn, h.featureHandler.HandleLogAction)
+	dupBanAllBtn := bot.DuplicateBanAllButton()
+	h.bot.Handle(&dupBanAllBtn, h.featureHandler.HandleDuplicateBanAll)
+	premodBtn := bot.PremodButton()
+	h.bot.Handle(&premodBtn, h.featureHandler.HandlePremod)
+	lockdownEndBtn := bot.LockdownEndButton()
+	h.bot.Handle(&lockdownEndBtn, h.featureHandler.HandleLockdownEnd)
+	h.bot.Handle("/appeal", h.adminHandler.HandleAppeal)
+	approveBtn, rejectBtn := bot.AppealApproveButton(), bot.AppealRejectButton()
+	h.bot.Handle(&approveBtn, h.adminHandler.HandleAppealApprove)
+	h.bot.Handle(&rejectBtn, h.adminHandler.HandleAppealReject)
 	h.bot.Handle("/ping", h.featureHandler.RateLimit(h.featureHandler.HandlePing))
 	h.bot.Handle("/start", h.featureHandler.HandleStart)
-	h.bot.Handle(tb.OnText, h.handleTextMessage)
+	h.bot.Handle(tb.OnText, h.handleMessage)
+	h.bot.Handle(tb.OnMedia, h.handleMessage)
+	h.bot.Handle(tb.OnContact, h.handleMessage)
+	h.bot.Poller = tb.NewMiddlewarePoller(h.bot.Poller, h.routePollMessages)
 	h.setBotCommands()
 }
 
-// handleTextMessage handles text messages
-func (h *Handler) handleTextMessage(c tb.Context) error {
-	if c.Chat().Type == tb.ChatPrivate {
-		if err := h.featureHandler.HandlePrivateMessage(c); err != nil {
-			return err
+// routePollMessages hands messages carrying a poll to the media handler, telebot routes them nowhere
+//
+// OnPoll only receives poll state updates, which have no chat.
+func (h *Handler) routePollMessages(u *tb.Update) bool {
+	if u.Message == nil || u.Message.Poll == nil {
+		return true
+	}
+	c := h.bot.NewContext(*u)
+	go func() {
+		if err := h.bot.Trigger(tb.OnMedia, c); err != nil {
+			logrus.WithError(err).Error("Failed to handle poll message")
 		}
+	}()
+	return false
+}
+
+// handleMigration follows a group to supergroup migration in all stores
+func (h *Handler) handleMigration(c tb.Context) error {
+	if err := h.adminHandler.HandleMigration(c); err != nil {
+		return err
+	}
+	if from, to := c.Migration(); from != 0 && to != 0 {
+		h.featureHandler.MigrateChat(from, to)
+	}
+	return nil
+}
+
+// handleMessage handles text and media messages
+func (h *Handler) handleMessage(c tb.Context) error {
+	if c.Message() == nil || c.Chat() == nil {
+		return nil
+	}
+	// Group filters like flood, duplicates and the classifier don't apply to private chats
+	if c.Chat().Type == tb.ChatPrivate {
+		return h.featureHandler.HandlePrivateMessage(c)
 	}
 	return h.featureHandler.FilterMessage(c)
 }
@@ -145,6 +216,16 @@ func (h *Handler) setBotCommands() {
 			{Text: "unbanword", Description: msgs.Commands.UnbanwordDesc},
 			{Text: "listbanword", Description: msgs.Commands.ListbanwordDesc},
 			{Text: "spamban", Description: msgs.Commands.SpambanDesc},
+			{Text: "unspamban", Description: msgs.Commands.UnspambanDesc},
+			{Text: "mute", Description: msgs.Commands.MuteDesc},
+			{Text: "unmute", Description: msgs.Commands.UnmuteDesc},
+			{Text: "violations", Description: msgs.Commands.ViolationsDesc},
+			{Text: "audit", Description: msgs.Commands.AuditDesc},
+			{Text: "flood", Description: msgs.Commands.FloodDesc},
+			{Text: "lock", Description: msgs.Commands.LockDesc},
+			{Text: "unlock", Description: msgs.Commands.UnlockDesc},
+			{Text: "locks", Description: msgs.Commands.LocksDesc},
+			{Text: "appeal", Description: msgs.Commands.AppealDesc},
 		}
 
 		_ = h.bot.SetCommands(commands, langCode)
@@ -158,6 +239,16 @@ func (h *Handler) setBotCommands() {
 		{Text: "unbanword", Description: msgsPL.Commands.UnbanwordDesc},
 		{Text: "listbanword", Description: msgsPL.Commands.ListbanwordDesc},
 		{Text: "spamban", Description: msgsPL.Commands.SpambanDesc},
+		{Text: "unspamban", Description: msgsPL.Commands.UnspambanDesc},
+		{Text: "mute", Description: msgsPL.Commands.MuteDesc},
+		{Text: "unmute", Description: msgsPL.Commands.UnmuteDesc},
+		{Text: "violations", Description: msgsPL.Commands.ViolationsDesc},
+		{Text: "audit", Description: msgsPL.Commands.AuditDesc},
+		{Text: "flood", Description: msgsPL.Commands.FloodDesc},
+		{Text: "lock", Description: msgsPL.Commands.LockDesc},
+		{Text: "unlock", Description: msgsPL.Commands.UnlockDesc},
+		{Text: "locks", Description: msgsPL.Commands.LocksDesc},
+		{Text: "appeal", Description: msgsPL.Commands.AppealDesc},
 	}
 	_ = h.bot.SetCommands(commandsDefault)
 }